@@ -0,0 +1,184 @@
+package p2pverse
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+
+	pb "github.com/pilinsin/p2p-verse/pb"
+	proto "google.golang.org/protobuf/proto"
+)
+
+//the encoding of FormatAddrInfos is
+//	base64url(version || proto(pb.AddrInfos) || sha256(version || proto(pb.AddrInfos))[:4])
+const (
+	addrInfoVersion  byte = 1
+	addrInfoChecksum      = 4
+)
+
+var ErrEmptyAddrInfo = errors.New("empty AddrInfo string")
+
+//FormatAddrInfos encodes ais into the string parsed by ParseAddrInfos.
+//A single AddrInfo is encoded as a list of one element.
+func FormatAddrInfos(ais ...peer.AddrInfo) string {
+	mais := make([]*pb.AddrInfo, len(ais))
+	for idx, ai := range ais {
+		mais[idx] = peerToPb(ai)
+	}
+	m, err := proto.Marshal(&pb.AddrInfos{AddrInfos: mais})
+	if err != nil {
+		return ""
+	}
+
+	buf := append([]byte{addrInfoVersion}, m...)
+	sum := sha256.Sum256(buf)
+	buf = append(buf, sum[:addrInfoChecksum]...)
+	return base64.URLEncoding.EncodeToString(buf)
+}
+
+//ParseAddrInfos accepts
+//the strings of FormatAddrInfos, AddrInfoToString and AddrInfosToString,
+//and multiaddrs with /p2p/ separated by commas or spaces, e.g. "/ip4/1.2.3.4/tcp/4001/p2p/12D3KooW...".
+//An error is returned if any of the AddrInfos is invalid.
+func ParseAddrInfos(s string) ([]peer.AddrInfo, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, ErrEmptyAddrInfo
+	}
+	if strings.HasPrefix(s, "/") {
+		return parseP2pAddrs(s)
+	}
+
+	m, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AddrInfo string: not base64url nor a multiaddr: %w", err)
+	}
+	if len(m) == 0 {
+		return nil, ErrEmptyAddrInfo
+	}
+
+	var mais []*pb.AddrInfo
+	if m[0] < 0x08 {
+		//a valid protobuf message does not start with a field number 0, so this is a version byte
+		if mais, err = decodeVersioned(m); err != nil {
+			return nil, err
+		}
+	} else if mais, err = decodeLegacy(m); err != nil {
+		return nil, err
+	}
+
+	if len(mais) == 0 {
+		return nil, errors.New("invalid AddrInfo string: no AddrInfo")
+	}
+	ais := make([]peer.AddrInfo, len(mais))
+	for idx, mai := range mais {
+		ai, err := pbToPeer(mai)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AddrInfo %d: %w", idx, err)
+		}
+		if err := checkAddrInfo(ai); err != nil {
+			return nil, fmt.Errorf("invalid AddrInfo %d: %w", idx, err)
+		}
+		ais[idx] = ai
+	}
+	return ais, nil
+}
+
+//ParseAddrInfo is ParseAddrInfos which requires exactly one peer.
+func ParseAddrInfo(s string) (peer.AddrInfo, error) {
+	ais, err := ParseAddrInfos(s)
+	if err != nil {
+		return peer.AddrInfo{}, err
+	}
+	if len(ais) != 1 {
+		return peer.AddrInfo{}, fmt.Errorf("invalid AddrInfo string: %d peers are given where one is expected", len(ais))
+	}
+	return ais[0], nil
+}
+
+func decodeVersioned(m []byte) ([]*pb.AddrInfo, error) {
+	if m[0] != addrInfoVersion {
+		return nil, fmt.Errorf("invalid AddrInfo string: unsupported version %d", m[0])
+	}
+	if len(m) < 1+addrInfoChecksum {
+		return nil, errors.New("invalid AddrInfo string: too short")
+	}
+	body, checksum := m[:len(m)-addrInfoChecksum], m[len(m)-addrInfoChecksum:]
+	sum := sha256.Sum256(body)
+	if !bytes.Equal(sum[:addrInfoChecksum], checksum) {
+		return nil, errors.New("invalid AddrInfo string: checksum mismatch, the string may be mistyped or truncated")
+	}
+
+	mais := &pb.AddrInfos{}
+	if err := proto.Unmarshal(body[1:], mais); err != nil {
+		return nil, fmt.Errorf("invalid AddrInfo string: %w", err)
+	}
+	return mais.GetAddrInfos(), nil
+}
+
+//decodeLegacy decodes the strings of AddrInfoToString and AddrInfosToString before the version byte.
+func decodeLegacy(m []byte) ([]*pb.AddrInfo, error) {
+	mais := &pb.AddrInfos{}
+	if err := proto.Unmarshal(m, mais); err == nil && len(mais.GetAddrInfos()) > 0 {
+		if _, err := peer.Decode(mais.GetAddrInfos()[0].GetID()); err == nil {
+			return mais.GetAddrInfos(), nil
+		}
+	}
+	mai := &pb.AddrInfo{}
+	if err := proto.Unmarshal(m, mai); err != nil {
+		return nil, fmt.Errorf("invalid AddrInfo string: %w", err)
+	}
+	return []*pb.AddrInfo{mai}, nil
+}
+
+func parseP2pAddrs(s string) ([]peer.AddrInfo, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	//the AddrInfos are in the order of the first multiaddr of each peer
+	ais := make([]peer.AddrInfo, 0, len(fields))
+	idxs := make(map[peer.ID]int)
+	for _, f := range fields {
+		maddr, err := ma.NewMultiaddr(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiaddr %q: %w", f, err)
+		}
+		if _, err := maddr.ValueForProtocol(ma.P_P2P); err != nil {
+			return nil, fmt.Errorf("invalid multiaddr %q: no /p2p/ peer ID", f)
+		}
+		ai, err := peer.AddrInfoFromP2pAddr(maddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiaddr %q: %w", f, err)
+		}
+
+		if idx, ok := idxs[ai.ID]; ok {
+			ais[idx].Addrs = append(ais[idx].Addrs, ai.Addrs...)
+			continue
+		}
+		idxs[ai.ID] = len(ais)
+		ais = append(ais, *ai)
+	}
+
+	for _, ai := range ais {
+		if err := checkAddrInfo(ai); err != nil {
+			return nil, err
+		}
+	}
+	return ais, nil
+}
+
+func checkAddrInfo(ai peer.AddrInfo) error {
+	if err := ai.ID.Validate(); err != nil {
+		return fmt.Errorf("invalid peer ID: %w", err)
+	}
+	if len(ai.Addrs) == 0 {
+		return fmt.Errorf("no addresses for peer %s", ai.ID)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	kad "github.com/libp2p/go-libp2p-kad-dht"
+	multierr "go.uber.org/multierr"
 )
 
 type HostGenerator func(seeds ...io.Reader) (host.Host, error)
@@ -34,52 +35,86 @@ func SampleHost(seeds ...io.Reader) (host.Host, error) {
 }
 
 type IBootstrap interface {
-	Close()
+	Close() error
 	AddrInfo() peer.AddrInfo
 	ConnectedPeers() []peer.AddrInfo
+	SubscribePeerEvents(context.Context) (<-chan PeerEvent, error)
+	Reconnector() *Reconnector
+	Host() host.Host
+	DHT() *kad.IpfsDHT
 }
 type bootstrap struct {
-	ctx   context.Context
-	h     host.Host
-	dht   *kad.IpfsDHT
-	peers []peer.AddrInfo
+	ctx     context.Context
+	cancel  func()
+	h       host.Host
+	dht     *kad.IpfsDHT
+	rc      *Reconnector
+	persist *bootstrapPersistence
 }
 
 func NewBootstrap(hGen HostGenerator, others ...peer.AddrInfo) (IBootstrap, error) {
+	return NewBootstrapContext(context.Background(), hGen, others...)
+}
+
+//the DHT of the bootstrap is closed when ctx is done.
+func NewBootstrapContext(ctx context.Context, hGen HostGenerator, others ...peer.AddrInfo) (IBootstrap, error) {
 	h, err := hGen()
 	if err != nil {
 		return nil, err
 	}
 
-	ctx := context.Background()
-	d, err := kad.New(ctx, h)
+	ctx, cancel := context.WithCancel(ctx)
+	d, err := newKad(ctx, h)
 	if err != nil {
+		cancel()
+		h.Close()
 		return nil, err
 	}
 
-	peers := make([]peer.AddrInfo, 0)
+	//the bootstrap starts even if the others are down, and the Reconnector retries them.
 	if len(others) > 0 {
-		if err := connectBootstraps(ctx, h, others); err != nil {
-			d.Close()
-			return nil, err
-		}
-		othersMap := AddrInfoSliceToMap(others)
-		for _, pid := range h.Network().Peers() {
-			if ai, ok := othersMap[pid]; ok {
-				peers = append(peers, ai)
-			}
+		if err := connectBootstraps(ctx, h, others, DefaultLogger()); err != nil {
+			DefaultLogger().Warn("bootstrap started without the other bootstraps", F("error", err))
 		}
 	}
 
-	return &bootstrap{ctx, h, d, peers}, nil
+	rc := NewReconnector(ctx, h)
+	rc.Add(others...)
+	return &bootstrap{ctx, cancel, h, d, rc, nil}, nil
+}
+
+//the peers are saved before the connections are closed.
+func (b *bootstrap) Close() error {
+	var err error
+	if b.persist != nil {
+		err = b.persist.close()
+	}
+	b.rc.Close()
+	b.cancel()
+	err = multierr.Append(err, b.dht.Close())
+	return multierr.Append(err, b.h.Close())
 }
-func (b *bootstrap) Close() {
-	b.dht.Close()
-	b.h.Close()
+func (b *bootstrap) Host() host.Host {
+	return b.h
+}
+func (b *bootstrap) DHT() *kad.IpfsDHT {
+	return b.dht
+}
+
+//the other bootstraps are reconnected while the bootstrap is running.
+func (b *bootstrap) Reconnector() *Reconnector {
+	return b.rc
 }
 func (b *bootstrap) AddrInfo() peer.AddrInfo {
 	return HostToAddrInfo(b.h)
 }
+
+//ConnectedPeers returns the peers connected at the moment.
 func (b *bootstrap) ConnectedPeers() []peer.AddrInfo {
-	return b.peers
+	return connectedPeers(b.h)
+}
+
+//the events are sent until ctx is done or the bootstrap is closed.
+func (b *bootstrap) SubscribePeerEvents(ctx context.Context) (<-chan PeerEvent, error) {
+	return subscribePeerEvents(ctx, b.ctx, b.h)
 }
@@ -5,7 +5,7 @@ import (
 	"encoding/base64"
 	"errors"
 
-	//"fmt"
+	"fmt"
 	//"strings"
 	//"time"
 
@@ -33,7 +33,7 @@ func stAddrToKey(stAddr string) string {
 }
 
 type IBootstrapStore interface {
-	Close()
+	Close() error
 	Address() string
 	Put(string, string) error
 	Get(string) ([]peer.AddrInfo, error)
@@ -42,11 +42,21 @@ type bootstrapStore struct {
 	store crdt.IUpdatableSignatureStore
 }
 
+//the store is shared through the public IPFS DHT.
 func NewBootstrapStore(dir string) (IBootstrapStore, error) {
 	p2pBsAddrInfos := kad.GetDefaultBootstrapPeerAddrInfos()
+	return NewBootstrapStoreWithHost(pv.SampleHost, dir, p2pBsAddrInfos...)
+}
+
+//the public IPFS bootstrap peers are never dialed,
+//so that the store can be shared in a private network created by pv.HostOpts.PSK.
+func NewBootstrapStoreWithHost(hGen pv.HostGenerator, dir string, bootstraps ...peer.AddrInfo) (IBootstrapStore, error) {
+	if len(bootstraps) == 0 {
+		return nil, errors.New("no bootstraps are given")
+	}
 	addr := crdt.MakeAddress(bStoreName, "", nil)
 
-	cv := crdt.NewVerse(pv.SampleHost, dir, false, p2pBsAddrInfos...)
+	cv := crdt.NewVerse(hGen, dir, false, bootstraps...)
 	tmp, err := cv.NewStore(addr, "updatableSignature")
 	if err != nil && tmp == nil {
 		return nil, err
@@ -55,23 +65,22 @@ func NewBootstrapStore(dir string) (IBootstrapStore, error) {
 	return &bootstrapStore{st}, nil
 }
 
-func (bs *bootstrapStore) Close() {
-	bs.store.Close()
+func (bs *bootstrapStore) Close() error {
+	return bs.store.Close()
 }
 func (bs *bootstrapStore) Address() string {
 	return bs.store.Address()
 }
+
+//bAddr is any string accepted by pv.ParseAddrInfos.
 func (bs *bootstrapStore) Put(stAddr, bAddr string) error {
-	ai := pv.AddrInfoFromString(bAddr)
-	if ai.ID == "" || len(ai.Addrs) == 0 {
-		ais := pv.AddrInfosFromString(bAddr)
-		if len(ais) == 0 {
-			return errors.New("invalid bootstrap address")
-		}
+	ais, err := pv.ParseAddrInfos(bAddr)
+	if err != nil {
+		return fmt.Errorf("invalid bootstrap address: %w", err)
 	}
 
 	key := stAddrToKey(stAddr)
-	val, err := base64.URLEncoding.DecodeString(bAddr)
+	val, err := base64.URLEncoding.DecodeString(pv.FormatAddrInfos(ais...))
 	if err != nil {
 		return err
 	}
@@ -90,17 +99,11 @@ func (bs *bootstrapStore) Get(stAddr string) ([]peer.AddrInfo, error) {
 	for res := range rs.Next() {
 		bAddr := base64.URLEncoding.EncodeToString(res.Value)
 
-		ai := pv.AddrInfoFromString(bAddr)
-		if ai.ID != "" && len(ai.Addrs) > 0 {
-			ais = append(ais, ai)
-			continue
-		}
-
-		tmp := pv.AddrInfosFromString(bAddr)
-		if len(tmp) == 0 {
-			ais = append(ais, tmp...)
+		tmp, err := pv.ParseAddrInfos(bAddr)
+		if err != nil {
 			continue
 		}
+		ais = append(ais, tmp...)
 	}
 
 	return ais, nil
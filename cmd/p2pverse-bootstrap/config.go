@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pnet "github.com/libp2p/go-libp2p-core/pnet"
+	pv "github.com/pilinsin/p2p-verse"
+)
+
+type config struct {
+	//listen multiaddrs
+	Listen []string `json:"listen"`
+	//the private key of the bootstrap, which is created if it does not exist
+	KeyFile string `json:"keyFile"`
+	//the peerstore and routing table of the bootstrap
+	DataDir string `json:"dataDir"`
+	//the strings accepted by pv.ParseAddrInfos of other bootstraps
+	Bootstraps []string `json:"bootstraps"`
+	//run as a circuit relay v2 service
+	Relay bool `json:"relay"`
+	//the address of the HTTP /status and /metrics endpoints, e.g. "127.0.0.1:8080" (disabled if empty)
+	HTTP string `json:"http"`
+	//a swarm.key file of a private network
+	PSKFile string `json:"pskFile"`
+}
+
+func defaultConfig() *config {
+	return &config{
+		Listen:  []string{"/ip4/0.0.0.0/tcp/4001", "/ip4/0.0.0.0/tcp/4002/ws"},
+		KeyFile: "p2pverse-bootstrap/key",
+		DataDir: "p2pverse-bootstrap/data",
+		HTTP:    "127.0.0.1:8080",
+	}
+}
+
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, ",")
+}
+func (sf *stringsFlag) Set(s string) error {
+	for _, elem := range strings.Split(s, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			*sf = append(*sf, elem)
+		}
+	}
+	return nil
+}
+
+//the values in the config file are overwritten by the flags given explicitly.
+func parseConfig(args []string) (*config, error) {
+	fs := flag.NewFlagSet("p2pverse-bootstrap", flag.ContinueOnError)
+	cfgFile := fs.String("config", "", "a JSON config file")
+	var listen, bootstraps stringsFlag
+	fs.Var(&listen, "listen", "comma separated listen multiaddrs")
+	fs.Var(&bootstraps, "bootstraps", "comma separated addresses of other bootstraps (FormatAddrInfos strings or /p2p/ multiaddrs)")
+	keyFile := fs.String("key", "", "the private key file, created if it does not exist")
+	dataDir := fs.String("data", "", "the directory of the peerstore and routing table")
+	relay := fs.Bool("relay", false, "run as a circuit relay v2 service")
+	httpAddr := fs.String("http", "", "the address of the HTTP status and metrics endpoints (\"off\" to disable)")
+	pskFile := fs.String("psk", "", "the swarm.key file of a private network")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	if *cfgFile != "" {
+		m, err := ioutil.ReadFile(*cfgFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(m, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.Listen = listen
+		case "bootstraps":
+			cfg.Bootstraps = bootstraps
+		case "key":
+			cfg.KeyFile = *keyFile
+		case "data":
+			cfg.DataDir = *dataDir
+		case "relay":
+			cfg.Relay = *relay
+		case "http":
+			cfg.HTTP = *httpAddr
+			if cfg.HTTP == "off" {
+				cfg.HTTP = ""
+			}
+		case "psk":
+			cfg.PSKFile = *pskFile
+		}
+	})
+	return cfg, nil
+}
+
+func (cfg *config) addrInfos() ([]peer.AddrInfo, error) {
+	ais := make([]peer.AddrInfo, 0)
+	for _, s := range cfg.Bootstraps {
+		tmp, err := pv.ParseAddrInfos(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap address %q: %w", s, err)
+		}
+		ais = append(ais, tmp...)
+	}
+	return ais, nil
+}
+
+func (cfg *config) hostOpts() (*pv.HostOpts, error) {
+	opt := &pv.HostOpts{
+		ListenAddrs:  cfg.Listen,
+		Reachability: pv.ReachabilityPublic,
+		RelayService: cfg.Relay,
+	}
+	if cfg.PSKFile != "" {
+		f, err := os.Open(cfg.PSKFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		psk, err := pnet.DecodeV1PSK(f)
+		if err != nil {
+			return nil, err
+		}
+		opt.PSK = psk
+	}
+	return opt, nil
+}
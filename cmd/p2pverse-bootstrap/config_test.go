@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfgFile := "test_config.json"
+	m := []byte(`{"listen": ["/ip4/127.0.0.1/tcp/4001"], "keyFile": "file.key", "relay": true}`)
+	if err := ioutil.WriteFile(cfgFile, m, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cfgFile)
+
+	cfg, err := parseConfig([]string{"-config", cfgFile, "-key", "flag.key", "-http", "off"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Listen) != 1 || cfg.Listen[0] != "/ip4/127.0.0.1/tcp/4001" {
+		t.Fatal("listen must be read from the config file:", cfg.Listen)
+	}
+	if cfg.KeyFile != "flag.key" {
+		t.Fatal("the flag must overwrite the config file:", cfg.KeyFile)
+	}
+	if !cfg.Relay || cfg.HTTP != "" {
+		t.Fatal("invalid relay or http:", cfg.Relay, cfg.HTTP)
+	}
+	if cfg.DataDir != defaultConfig().DataDir {
+		t.Fatal("the default data dir must be used:", cfg.DataDir)
+	}
+
+	cfg.Bootstraps = []string{"invalid"}
+	if _, err := cfg.addrInfos(); err == nil {
+		t.Fatal("an invalid bootstrap address must be rejected")
+	}
+	cfg.Bootstraps = []string{"/ip4/127.0.0.1/tcp/4001/p2p/12D3KooWD3eckifWpRn9wQpMG9R9hX3sD158z7EqHWmweQAJU5SA"}
+	if ais, err := cfg.addrInfos(); err != nil || len(ais) != 1 {
+		t.Fatal("a /p2p/ multiaddr must be accepted:", err)
+	}
+}
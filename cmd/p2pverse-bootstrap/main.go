@@ -0,0 +1,135 @@
+//p2pverse-bootstrap runs a bootstrap node of p2p-verse.
+//
+//	p2pverse-bootstrap -listen /ip4/0.0.0.0/tcp/4001 -key bootstrap.key -http 127.0.0.1:8080
+//	p2pverse-bootstrap -config bootstrap.json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	pv "github.com/pilinsin/p2p-verse"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "p2pverse-bootstrap:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	cfg, err := parseConfig(args)
+	if err != nil {
+		return err
+	}
+	others, err := cfg.addrInfos()
+	if err != nil {
+		return err
+	}
+	hOpt, err := cfg.hostOpts()
+	if err != nil {
+		return err
+	}
+
+	hGen := pv.NewHostGenerator(hOpt)
+	b, err := pv.NewPersistentBootstrap(hGen, cfg.KeyFile, cfg.DataDir, others...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := b.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "p2pverse-bootstrap: close:", err)
+		}
+	}()
+
+	fmt.Println("peer ID:", b.AddrInfo().ID)
+	for _, addr := range b.AddrInfo().Addrs {
+		fmt.Println("listen:", addr)
+	}
+	fmt.Println("address:", pv.AddrInfoToString(b.AddrInfo()))
+
+	metrics := pv.DefaultMetrics()
+	metrics.Describe("p2pverse_bootstrap_connected_peers", pv.GaugeMetric, "The number of the peers connected to the bootstrap.")
+	metrics.Describe("p2pverse_bootstrap_routing_table_size", pv.GaugeMetric, "The number of the peers in the routing table of the bootstrap.")
+	metrics.Register(pv.CollectorFunc(func() []pv.Sample {
+		return []pv.Sample{
+			{Name: "p2pverse_bootstrap_connected_peers", Value: float64(len(b.ConnectedPeers()))},
+			{Name: "p2pverse_bootstrap_routing_table_size", Value: float64(b.DHT().RoutingTable().Size())},
+		}
+	}))
+
+	//the status endpoint is bound before serving, so that a bad listen address stops the bootstrap
+	var srv *http.Server
+	srvErr := make(chan error, 1)
+	if cfg.HTTP != "" {
+		ln, err := net.Listen("tcp", cfg.HTTP)
+		if err != nil {
+			return fmt.Errorf("status endpoint: %w", err)
+		}
+		srv = &http.Server{Handler: statusHandler(b)}
+		go func() {
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				srvErr <- err
+			}
+		}()
+		fmt.Println("status: http://" + cfg.HTTP + "/status")
+		fmt.Println("metrics: http://" + cfg.HTTP + "/metrics")
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sig:
+	case err := <-srvErr:
+		return fmt.Errorf("status endpoint: %w", err)
+	}
+	fmt.Println("shutting down...")
+
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}
+	return nil
+}
+
+type status struct {
+	ID               string   `json:"id"`
+	Address          string   `json:"address"`
+	Addrs            []string `json:"addrs"`
+	ConnectedPeers   []string `json:"connectedPeers"`
+	RoutingTableSize int      `json:"routingTableSize"`
+}
+
+func statusHandler(b pv.IBootstrap) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		ai := b.AddrInfo()
+		st := status{
+			ID:               ai.ID.String(),
+			Address:          pv.AddrInfoToString(ai),
+			Addrs:            make([]string, 0, len(ai.Addrs)),
+			ConnectedPeers:   make([]string, 0),
+			RoutingTableSize: b.DHT().RoutingTable().Size(),
+		}
+		for _, addr := range ai.Addrs {
+			st.Addrs = append(st.Addrs, addr.String())
+		}
+		for _, ai := range b.ConnectedPeers() {
+			st.ConnectedPeers = append(st.ConnectedPeers, ai.ID.String())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(st)
+	})
+	mux.Handle("/metrics", pv.DefaultMetrics().Handler())
+	return mux
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestStatusListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	defer os.RemoveAll("test_bootstrap")
+
+	args := []string{
+		"-listen", "/ip4/127.0.0.1/tcp/0",
+		"-key", "test_bootstrap/key",
+		"-data", "test_bootstrap/data",
+		"-http", ln.Addr().String(),
+	}
+	if err := run(args); err == nil {
+		t.Fatal("the status endpoint on a used address must fail")
+	}
+}
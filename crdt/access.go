@@ -1,60 +1,24 @@
 package crdtverse
 
 import (
-	"crypto/rand"
+	"context"
 	"encoding/base64"
 	"errors"
 	"strings"
+	"time"
 
 	query "github.com/ipfs/go-datastore/query"
 	pb "github.com/pilinsin/p2p-verse/crdt/pb"
 	proto "google.golang.org/protobuf/proto"
 )
 
-type acFilter struct{}
-
-func (f acFilter) Filter(e query.Entry) bool {
-	//sig key is /pid/acKey/...
-	//hash key is /hash(acKey, salt)/...
-	pub := f.extractPubKey(e.Key)
-	if pub == nil {
-		return false
-	}
-
-	sd := &pb.SignatureData{}
-	if err := proto.Unmarshal(e.Value, sd); err != nil {
-		return false
-	}
-	ok, err := pub.Verify(sd.GetValue(), sd.GetSign())
-	return ok && err == nil
-}
-func (f acFilter) extractPubKey(key string) IPubKey {
-	keys := strings.Split(strings.TrimPrefix(key, "/"), "/")
-	if len(keys) == 0 {
-		return nil
-	}
-	for _, maybeAcKey := range keys {
-		mak, err := base64.URLEncoding.DecodeString(maybeAcKey)
-		if err != nil {
-			continue
-		}
-		pak := &pb.AccessKey{}
-		if err := proto.Unmarshal(mak, pak); err != nil {
-			continue
-		}
-		if pub, err := StrToPubKey(pak.GetMasterKey()); err == nil {
-			return pub
-		}
-	}
-	return nil
-}
-
 type acVerifyFilter struct {
-	ac IAccessStore
+	ctx context.Context
+	ac  *accessStore
 }
 
 func (f acVerifyFilter) Filter(e query.Entry) bool {
-	err := f.ac.Verify(e.Key)
+	err := f.ac.verifyContext(f.ctx, e.Key, RoleWrite)
 	return err == nil
 }
 
@@ -72,20 +36,56 @@ func getAccessOpts(opts ...*StoreOpts) (IPrivKey, IPubKey) {
 type IAccessBaseStore interface {
 	IStore
 	putKey(string) string
-	acQuery(string) (query.Results, error)
+	acQuery(context.Context, string) (query.Results, error)
 	accessFromKey(string) string
 }
+
+//Role is a set of the permissions of an access.
+type Role uint32
+
+const (
+	//RoleRead permits Get, Has and Query of the values.
+	//it is checked only by the local store and is advisory,
+	//since the values are replicated to every peer of the store and can be read from its datastore.
+	RoleRead Role = 1 << iota
+	//RoleWrite permits Put and Delete, and the values put by the access are verified.
+	RoleWrite
+	//RoleAdmin also permits granting and revoking RoleRead and RoleWrite of the others.
+	RoleAdmin
+)
+
+//AnyAccess is the access of everyone, e.g. Grant(AnyAccess, RoleRead) makes a store world-readable.
+const AnyAccess = "*"
+
+func (r Role) has(want Role) bool {
+	return r&RoleAdmin != 0 || r&want == want
+}
+
 type IAccessStore interface {
 	IAccessBaseStore
 	IUpdatableStore
 	ISignatureStore
-	Grant(string) error
+	Grant(string, Role) error
+	GrantUntil(string, Role, time.Time) error
+	Revoke(string) error
 	Verify(string) error
+	VerifyRole(string, Role) error
 }
+
+//the grants and the revocations are signed by the master key of the store, i.e. the pid of its address,
+//or by an admin granted by the master key. An admin cannot grant or revoke RoleAdmin.
+//an access can also delegate a narrower grant of its own with the proof of it (see delegation.go).
+//an access has the roles of its grants in effect (see validGrants), i.e. not expired and with no revocation after them,
+//except the master key, which has every role without a grant.
+//a revocation by the master key is also after the grants of the others, and the times in the future are skipped until then.
+//the grants and the revocations of an admin are valid only while the admin has RoleAdmin.
+//the grants and the revocations are appended at <access key>/<time>, so that a base store which is not updatable keeps all of them.
 type accessStore struct {
 	IAccessBaseStore
 	priv IPrivKey
 	pub  IPubKey
+	//the pid of priv
+	issuer string
 }
 
 func (cv *crdtVerse) NewAccessStore(st IStore, accesses <-chan string, opts ...*StoreOpts) (IAccessStore, error) {
@@ -99,44 +99,155 @@ func (cv *crdtVerse) NewAccessStore(st IStore, accesses <-chan string, opts ...*
 		IAccessBaseStore: base,
 		priv:             priv,
 		pub:              pub,
+		issuer:           PubKeyToStr(pub),
 	}
 
+	public := RoleRead
+	if len(opts) > 0 && opts[0].PrivateRead {
+		public &^= RoleRead
+	}
+	if len(opts) > 0 && opts[0].PublicWrite {
+		public |= RoleWrite
+	}
+	if public != 0 {
+		if err := ac.Grant(AnyAccess, public); err != nil {
+			ac.Close()
+			return nil, err
+		}
+	}
 	for access := range accesses {
-		if err := ac.Grant(access); err != nil {
+		if err := ac.Grant(access, RoleWrite); err != nil {
 			ac.Close()
 			return nil, err
 		}
 	}
-	ac.priv = nil
 	return ac, nil
 }
-func (s *accessStore) Grant(access string) error {
+
+//Grant gives a role to an access without expiry.
+func (s *accessStore) Grant(access string, role Role) error {
+	return s.GrantUntil(access, role, time.Time{})
+}
+
+//GrantUntil gives a role to an access until expiry. A zero expiry never expires.
+//A grant replaces the previous ones of the access by the issuers of the same or lower authority,
+//and a delegated grant only adds the role to the others.
+//Without the master key or RoleAdmin, the grant is delegated from the grant of the key pair of the store.
+func (s *accessStore) GrantUntil(access string, role Role, expiry time.Time) error {
+	ctx := s.storeContext()
+	if role&RoleAdmin != 0 && access == AnyAccess {
+		return errors.New("RoleAdmin cannot be granted to AnyAccess")
+	}
 	if s.priv == nil {
 		return errors.New("no valid privKey")
 	}
 
-	val := make([]byte, 32)
-	rand.Read(val)
-	sign, err := s.priv.Sign(val)
+	tb, err := time.Now().UTC().MarshalBinary()
 	if err != nil {
 		return err
 	}
-	sd := &pb.SignatureData{
-		Value: val,
-		Sign:  sign,
+	eb, err := expiry.UTC().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	grant := &pb.Grant{
+		MasterKey: PubKeyToStr(s.pub),
+		Access:    access,
+		Scope:     s.storeName(),
+		Time:      tb,
+		Expiry:    eb,
+		Role:      uint32(role),
+		Issuer:    s.issuer,
 	}
-	msd, err := proto.Marshal(sd)
+	proof, err := s.issuerProof(ctx, grant)
+	if err != nil {
+		return err
+	}
+	grant.Proof = proof
+	msd, err := s.signAccess(grant)
 	if err != nil {
 		return err
 	}
 
-	acKey := s.accessKey(access)
+	acKey := s.accessKey(access, false)
 	if acKey == "" {
 		return errors.New("accessKey generation error")
 	}
-	return s.IAccessBaseStore.Put(acKey, msd)
+	return s.IAccessBaseStore.PutContext(ctx, recordKey(acKey, tb), msd)
+}
+
+//Revoke takes all the roles of an access back from the time of the revocation.
+//A revocation by an admin does not take the roles granted by the master key.
+//The values put by the access are no longer verified.
+func (s *accessStore) Revoke(access string) error {
+	ctx := s.storeContext()
+	role, err := s.grantedRole(ctx, access, true)
+	if err != nil {
+		return err
+	}
+	if err := s.checkIssuer(ctx, role); err != nil {
+		return err
+	}
+
+	tb, err := time.Now().UTC().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	rev := &pb.Revocation{
+		MasterKey: PubKeyToStr(s.pub),
+		Access:    access,
+		Scope:     s.storeName(),
+		Time:      tb,
+		Issuer:    s.issuer,
+	}
+	msd, err := s.signAccess(rev)
+	if err != nil {
+		return err
+	}
+
+	revKey := s.accessKey(access, true)
+	if revKey == "" {
+		return errors.New("accessKey generation error")
+	}
+	return s.IAccessBaseStore.PutContext(ctx, recordKey(revKey, tb), msd)
 }
-func (s *accessStore) accessKey(access string) string {
+
+//checkIssuer checks that the key pair of the store can grant or revoke role.
+func (s *accessStore) checkIssuer(ctx context.Context, role Role) error {
+	if s.priv == nil {
+		return errors.New("no valid privKey")
+	}
+	if s.issuer == PubKeyToStr(s.pub) {
+		return nil
+	}
+	if role&RoleAdmin != 0 {
+		return errors.New("only the master key can grant and revoke RoleAdmin")
+	}
+	adminRole, err := s.grantedRole(ctx, s.issuer, false)
+	if err != nil {
+		return err
+	}
+	if adminRole&RoleAdmin == 0 {
+		return errors.New("no admin permission")
+	}
+	return nil
+}
+func (s *accessStore) signAccess(m proto.Message) ([]byte, error) {
+	val, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := s.priv.Sign(val)
+	if err != nil {
+		return nil, err
+	}
+	sd := &pb.SignatureData{
+		Value: val,
+		Sign:  sign,
+	}
+	return proto.Marshal(sd)
+}
+func (s *accessStore) accessKey(access string, revoked bool) string {
 	sKey := PubKeyToStr(s.pub)
 	if sKey == "" {
 		return ""
@@ -144,6 +255,7 @@ func (s *accessStore) accessKey(access string) string {
 	key := &pb.AccessKey{
 		MasterKey: sKey,
 		Access:    access,
+		Revoked:   revoked,
 	}
 	m, err := proto.Marshal(key)
 	if err != nil {
@@ -152,13 +264,19 @@ func (s *accessStore) accessKey(access string) string {
 	return base64.URLEncoding.EncodeToString(m)
 }
 
+//recordKey returns the key of a grant or a revocation of acKey at the signed time tb.
+func recordKey(acKey string, tb []byte) string {
+	return acKey + "/" + base64.URLEncoding.EncodeToString(tb)
+}
+
+//the key pair of opts is the master key or an admin.
 func (cv *crdtVerse) loadAccessStore(st IStore, pid string, opts ...*StoreOpts) (IAccessStore, error) {
 	base, ok := st.(IAccessBaseStore)
 	if !ok {
 		return nil, errors.New("invalid base store")
 	}
 
-	priv, _ := getAccessOpts(opts...)
+	priv, optPub := getAccessOpts(opts...)
 	pub, err := StrToPubKey(pid)
 	if err != nil {
 		return nil, err
@@ -167,6 +285,7 @@ func (cv *crdtVerse) loadAccessStore(st IStore, pid string, opts ...*StoreOpts)
 		IAccessBaseStore: base,
 		priv:             priv,
 		pub:              pub,
+		issuer:           PubKeyToStr(optPub),
 	}
 	return ac, nil
 }
@@ -187,8 +306,15 @@ func (s *accessStore) ResetKeyPair(priv IPrivKey, pub IPubKey) {
 	}
 }
 
+//Verify checks that the access of key has RoleWrite, i.e. the value of key is valid.
 func (s *accessStore) Verify(key string) error {
-	ok, err := s.verify(key)
+	return s.VerifyRole(key, RoleWrite)
+}
+func (s *accessStore) VerifyRole(key string, role Role) error {
+	return s.verifyContext(s.storeContext(), key, role)
+}
+func (s *accessStore) verifyContext(ctx context.Context, key string, role Role) error {
+	ok, err := s.verify(ctx, key, role)
 	if err != nil {
 		return err
 	}
@@ -197,46 +323,295 @@ func (s *accessStore) Verify(key string) error {
 	}
 	return nil
 }
-func (s *accessStore) verify(key string) (bool, error) {
+func (s *accessStore) verify(ctx context.Context, key string, role Role) (bool, error) {
 	key = strings.TrimPrefix(key, "/")
 	access := s.accessFromKey(key)
 	if access == "" {
 		return false, errors.New("invalid access error")
 	}
-	acKey := s.accessKey(access)
-	if acKey == "" {
-		return false, errors.New("accessKey generation error")
+	//the master key has every role
+	if access == PubKeyToStr(s.pub) {
+		return true, nil
 	}
 
-	rs, err := s.acQuery(acKey)
+	granted, err := s.grantedRole(ctx, access, true)
+	if err != nil {
+		return false, err
+	}
+	if access != AnyAccess && granted.has(role) {
+		return true, nil
+	}
+	public, err := s.grantedRole(ctx, AnyAccess, true)
 	if err != nil {
 		return false, err
 	}
-	rs = query.NaiveFilter(rs, acFilter{})
+	if access == AnyAccess {
+		granted = 0
+	}
+	return (granted | public&^RoleAdmin).has(role), nil
+}
+
+//verifyRead checks RoleRead of the key pair of the store.
+//the reads of a hash store are not checked since it has no identity of the reader,
+//and the holder of the master key can always read.
+func (s *accessStore) verifyRead(ctx context.Context) error {
+	if s.issuer == PubKeyToStr(s.pub) {
+		return nil
+	}
+	if _, ok := s.IAccessBaseStore.(ISignatureStore); !ok {
+		return nil
+	}
+	return s.verifyContext(ctx, s.putKey(""), RoleRead)
+}
+
+//grantedRole returns the union of the roles of the grants of access in effect.
+//the grants and the revocations of the admins are also valid if byAdmin.
+func (s *accessStore) grantedRole(ctx context.Context, access string, byAdmin bool) (Role, error) {
+	grants, err := s.validGrants(ctx, access, byAdmin, maxDelegationDepth)
+	var role Role
+	for _, g := range grants {
+		role |= Role(g.grant.GetRole())
+	}
+	return role, err
+}
+
+//the authorities of the issuers of the grants
+const (
+	delegateAuthority = iota + 1
+	adminAuthority
+	masterAuthority
+)
+
+type signedGrant struct {
+	grant     *pb.Grant
+	sd        *pb.SignatureData
+	time      time.Time
+	expiry    time.Time
+	authority int
+}
+
+//validGrants returns the grants of access in effect with their signed data.
+//a grant replaces the earlier grants by the issuers of the same or lower authority, i.e. the master key, an admin and a delegate in order,
+//so that a delegated grant only adds a role to the grants by the master key and the admins.
+//the grants which are replaced, expired or revoked are not in effect.
+//depth bounds the chains of the proofs of the delegated grants.
+func (s *accessStore) validGrants(ctx context.Context, access string, byAdmin bool, depth int) ([]*signedGrant, error) {
+	isIssuer := s.issuerFunc(ctx, byAdmin)
+	master := PubKeyToStr(s.pub)
+
+	grants := make([]*signedGrant, 0)
+	err := s.acRecords(ctx, access, false, func(sd *pb.SignatureData) {
+		grant := &pb.Grant{}
+		if err := proto.Unmarshal(sd.GetValue(), grant); err != nil {
+			return
+		}
+		if !s.inScope(grant.GetMasterKey(), grant.GetAccess(), grant.GetScope(), access) {
+			return
+		}
+		t, e, ok := grantTimes(grant)
+		if !ok {
+			return
+		}
+		if !signedBy(grant.GetIssuer(), sd.GetValue(), sd.GetSign()) {
+			return
+		}
+
+		var authority int
+		switch {
+		case grant.GetIssuer() == master:
+			authority = masterAuthority
+		case isIssuer(grant.GetIssuer(), Role(grant.GetRole())):
+			authority = adminAuthority
+		//RoleAdmin, i.e. !byAdmin, is not delegated
+		case byAdmin && s.validProof(ctx, grant, depth):
+			authority = delegateAuthority
+		default:
+			return
+		}
+		grants = append(grants, &signedGrant{grant, sd, t, e, authority})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	valid := make([]*signedGrant, 0, len(grants))
+	for _, g := range grants {
+		if replaced(g, grants) || isExpired(g.expiry) {
+			continue
+		}
+		revoked, err := s.revoked(ctx, g, isIssuer)
+		if err != nil {
+			return nil, err
+		}
+		if !revoked {
+			valid = append(valid, g)
+		}
+	}
+	return valid, nil
+}
+
+//replaced reports whether there is a later grant than g by an issuer of the same or higher authority.
+func replaced(g *signedGrant, grants []*signedGrant) bool {
+	for _, other := range grants {
+		if other.authority >= g.authority && other.time.After(g.time) {
+			return true
+		}
+	}
+	return false
+}
+
+//revoked reports whether there is a revocation of the access of g after g.
+//a revocation by the master key is valid regardless of the time for a grant by the others,
+//since the time of a grant is signed by its issuer.
+//the revocations of the admins are valid neither for RoleAdmin nor for the grants by the master key.
+func (s *accessStore) revoked(ctx context.Context, g *signedGrant, isIssuer func(string, Role) bool) (bool, error) {
+	role := Role(g.grant.GetRole())
+	master := PubKeyToStr(s.pub)
+
+	revoked := false
+	err := s.acRecords(ctx, g.grant.GetAccess(), true, func(sd *pb.SignatureData) {
+		rev := &pb.Revocation{}
+		if err := proto.Unmarshal(sd.GetValue(), rev); err != nil {
+			return
+		}
+		if !s.inScope(rev.GetMasterKey(), rev.GetAccess(), rev.GetScope(), g.grant.GetAccess()) {
+			return
+		}
+		t := time.Time{}
+		if err := t.UnmarshalBinary(rev.GetTime()); err != nil || isFuture(t) {
+			return
+		}
+		byMaster := rev.GetIssuer() == master
+		if !byMaster && g.authority == masterAuthority {
+			return
+		}
+		if t.Before(g.time) && !(byMaster && g.authority != masterAuthority) {
+			return
+		}
+		if isIssuer(rev.GetIssuer(), role) && signedBy(rev.GetIssuer(), sd.GetValue(), sd.GetSign()) {
+			revoked = true
+		}
+	})
+	return revoked, err
+}
+
+//issuerFunc returns a function which reports whether issuer can grant or revoke role without a proof,
+//i.e. issuer is the master key, or an admin if byAdmin.
+func (s *accessStore) issuerFunc(ctx context.Context, byAdmin bool) func(string, Role) bool {
+	master := PubKeyToStr(s.pub)
+	admins := make(map[string]bool)
+	return func(issuer string, role Role) bool {
+		if issuer == master {
+			return true
+		}
+		if !byAdmin || role&RoleAdmin != 0 {
+			return false
+		}
+		if ok, found := admins[issuer]; found {
+			return ok
+		}
+		adminRole, err := s.grantedRole(ctx, issuer, false)
+		admins[issuer] = err == nil && adminRole&RoleAdmin != 0
+		return admins[issuer]
+	}
+}
+
+//acRecords calls f with the signed grants or revocations of access.
+func (s *accessStore) acRecords(ctx context.Context, access string, revoked bool, f func(*pb.SignatureData)) error {
+	acKey := s.accessKey(access, revoked)
+	if acKey == "" {
+		return errors.New("accessKey generation error")
+	}
+
+	rs, err := s.acQuery(ctx, acKey)
+	if err != nil {
+		return err
+	}
 	resList, err := rs.Rest()
-	return len(resList) > 0, err
+	if err != nil {
+		return err
+	}
+	for _, res := range resList {
+		sd := &pb.SignatureData{}
+		if err := proto.Unmarshal(res.Value, sd); err != nil {
+			continue
+		}
+		f(sd)
+	}
+	return nil
+}
+func signedBy(issuer string, val, sign []byte) bool {
+	vk, err := StrToPubKey(issuer)
+	if err != nil {
+		return false
+	}
+	ok, err := vk.Verify(val, sign)
+	return err == nil && ok
+}
+
+//a signed record is bound to the master key, the access and the store,
+//so that it cannot be copied to another access or store.
+func (s *accessStore) inScope(masterKey, access, scope, want string) bool {
+	return masterKey == PubKeyToStr(s.pub) && access == want && scope == s.storeName()
 }
 
 func (s *accessStore) Put(key string, val []byte) error {
-	if err := s.Verify(s.putKey(key)); err != nil {
+	return s.PutContext(s.storeContext(), key, val)
+}
+func (s *accessStore) PutContext(ctx context.Context, key string, val []byte) error {
+	if err := s.verifyContext(ctx, s.putKey(key), RoleWrite); err != nil {
+		return err
+	}
+
+	return s.IAccessBaseStore.PutContext(ctx, key, val)
+}
+func (s *accessStore) Delete(key string) error {
+	return s.DeleteContext(s.storeContext(), key)
+}
+func (s *accessStore) DeleteContext(ctx context.Context, key string) error {
+	sig, ok := s.IAccessBaseStore.(ISignatureStore)
+	if !ok {
+		return errors.New("not implemented error")
+	}
+	if err := s.verifyContext(ctx, s.putKey(key), RoleWrite); err != nil {
 		return err
 	}
 
-	return s.IAccessBaseStore.Put(key, val)
+	return sig.DeleteContext(ctx, key)
+}
+func (s *accessStore) MigrateSignatures() error {
+	return s.MigrateSignaturesContext(s.storeContext())
+}
+func (s *accessStore) MigrateSignaturesContext(ctx context.Context) error {
+	sig, ok := s.IAccessBaseStore.(ISignatureStore)
+	if !ok {
+		return errors.New("not implemented error")
+	}
+	return sig.MigrateSignaturesContext(ctx)
 }
 func (s *accessStore) Get(key string) ([]byte, error) {
-	if err := s.Verify(key); err != nil {
+	return s.GetContext(s.storeContext(), key)
+}
+func (s *accessStore) GetContext(ctx context.Context, key string) ([]byte, error) {
+	if err := s.verifyRead(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.verifyContext(ctx, key, RoleWrite); err != nil {
 		if _, ok := s.IAccessBaseStore.(*hashStore); !ok {
 			return nil, err
 		}
-		if err := s.Verify(s.putKey(key)); err != nil {
+		if err := s.verifyContext(ctx, s.putKey(key), RoleWrite); err != nil {
 			return nil, err
 		}
 	}
 
-	return s.IAccessBaseStore.Get(key)
+	return s.IAccessBaseStore.GetContext(ctx, key)
 }
 func (s *accessStore) GetSize(key string) (int, error) {
+	ctx := s.storeContext()
+	if err := s.verifyRead(ctx); err != nil {
+		return -1, err
+	}
 	if err := s.Verify(key); err != nil {
 		if _, ok := s.IAccessBaseStore.(*hashStore); !ok {
 			return -1, err
@@ -249,19 +624,33 @@ func (s *accessStore) GetSize(key string) (int, error) {
 	return s.IAccessBaseStore.GetSize(key)
 }
 func (s *accessStore) Has(key string) (bool, error) {
-	if err := s.Verify(key); err != nil {
+	return s.HasContext(s.storeContext(), key)
+}
+func (s *accessStore) HasContext(ctx context.Context, key string) (bool, error) {
+	if err := s.verifyRead(ctx); err != nil {
+		return false, err
+	}
+	if err := s.verifyContext(ctx, key, RoleWrite); err != nil {
 		if _, ok := s.IAccessBaseStore.(*hashStore); !ok {
 			return false, err
 		}
-		if err := s.Verify(s.putKey(key)); err != nil {
+		if err := s.verifyContext(ctx, s.putKey(key), RoleWrite); err != nil {
 			return false, err
 		}
 	}
 
-	return s.IAccessBaseStore.Has(key)
+	return s.IAccessBaseStore.HasContext(ctx, key)
 }
 func (s *accessStore) Query(qs ...query.Query) (query.Results, error) {
-	rs, err := s.IAccessBaseStore.Query()
+	return s.QueryContext(s.storeContext(), qs...)
+}
+
+//the results are empty without RoleRead as the values of the accesses without RoleWrite are filtered.
+func (s *accessStore) QueryContext(ctx context.Context, qs ...query.Query) (query.Results, error) {
+	if err := s.verifyRead(ctx); err != nil {
+		return query.ResultsWithEntries(query.Query{}, nil), nil
+	}
+	rs, err := s.IAccessBaseStore.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -272,12 +661,18 @@ func (s *accessStore) Query(qs ...query.Query) (query.Results, error) {
 	} else {
 		q = qs[0]
 	}
-	q.Filters = append(q.Filters, acVerifyFilter{ac: s})
+	q.Filters = append(q.Filters, acVerifyFilter{ctx: ctx, ac: s})
 	return query.NaiveQueryApply(q, rs), nil
 }
 func (s *accessStore) QueryAll(qs ...query.Query) (query.Results, error) {
+	return s.QueryAllContext(s.storeContext(), qs...)
+}
+func (s *accessStore) QueryAllContext(ctx context.Context, qs ...query.Query) (query.Results, error) {
 	if us, ok := s.IAccessBaseStore.(IUpdatableSignatureStore); ok {
-		rs, err := us.QueryAll()
+		if err := s.verifyRead(ctx); err != nil {
+			return query.ResultsWithEntries(query.Query{}, nil), nil
+		}
+		rs, err := us.QueryAllContext(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -288,7 +683,7 @@ func (s *accessStore) QueryAll(qs ...query.Query) (query.Results, error) {
 		} else {
 			q = qs[0]
 		}
-		q.Filters = append(q.Filters, acVerifyFilter{ac: s})
+		q.Filters = append(q.Filters, acVerifyFilter{ctx: ctx, ac: s})
 		return query.NaiveQueryApply(q, rs), nil
 	}
 
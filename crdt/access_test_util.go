@@ -6,6 +6,7 @@ import (
 	"time"
 
 	pv "github.com/pilinsin/p2p-verse"
+	pb "github.com/pilinsin/p2p-verse/crdt/pb"
 )
 
 func testHashAccess(t *testing.T, hGen pv.HostGenerator, baiStr string) {
@@ -39,6 +40,20 @@ func testHashAccess(t *testing.T, hGen pv.HostGenerator, baiStr string) {
 	checkError(t, err)
 	assertError(t, len(resList) > 0, "valid data must be exist")
 
+	//a base store which is not updatable keeps all the grants and the revocations
+	ac0 := db0.(IAccessStore)
+	ac1 := db1.(IAccessStore)
+	bbb := ac0.putKey("bbb")
+	checkError(t, ac0.Grant(bbb, RoleWrite))
+	checkError(t, ac0.Revoke(bbb))
+	assertError(t, ac0.Verify(bbb) != nil, "the revoked access must not be verified")
+	checkError(t, ac0.Grant(bbb, RoleWrite), "the 2nd Grant must not be fail")
+	checkError(t, ac0.Verify(bbb), "the granted access must be verified")
+	t.Log("regrant done")
+	time.Sleep(time.Second * 10)
+
+	checkError(t, ac1.Verify(bbb), "the regranted access must be replicated")
+
 	db0.Close()
 	db1.Close()
 	time.Sleep(time.Second)
@@ -53,7 +68,9 @@ func testSignatureAccess(t *testing.T, hGen pv.HostGenerator, baiStr string) {
 	db0 = newAccessStore(t, db0, pid)
 	t.Log("db0 generated")
 
-	db1 := newStore(t, hGen, "ac/ab", db0.Address(), "updatableSignature", baiStr)
+	opts1 := &StoreOpts{}
+	db1 := newStore(t, hGen, "ac/ab", db0.Address(), "updatableSignature", baiStr, opts1)
+	pid1 := PubKeyToStr(opts1.Pub)
 	t.Log("db1 generated")
 
 	checkError(t, db0.Put("aaa", []byte("meow meow ^.^")))
@@ -70,12 +87,144 @@ func testSignatureAccess(t *testing.T, hGen pv.HostGenerator, baiStr string) {
 	checkError(t, err)
 	assertError(t, len(resList) > 0, "valid data must be exist")
 
+	ac0 := db0.(IAccessStore)
+	ac1 := db1.(IAccessStore)
+	checkError(t, ac0.Revoke(pid))
+	t.Log("revoke done")
+	time.Sleep(time.Second * 10)
+
+	assertError(t, ac1.Verify(pid) != nil, "the revoked access must not be verified")
+	_, err = db1.Get(pid + "/aaa")
+	assertError(t, err != nil, "the value of the revoked access must not be got")
+	assertError(t, db0.Put("bbb", []byte("meow")) != nil, "Put of the revoked access must be fail")
+
+	checkError(t, ac0.GrantUntil(pid, RoleWrite, time.Now().Add(time.Second*15)))
+	t.Log("grant done")
+	time.Sleep(time.Second * 10)
+
+	checkError(t, ac1.Verify(pid), "the granted access must be verified")
+	v11, err := db1.Get(pid + "/aaa")
+	checkError(t, err)
+	t.Log("db1.Get:", string(v11))
+	assertError(t, ac1.Revoke(pid) != nil, "Revoke without the master key must be fail")
+
+	time.Sleep(time.Second * 6)
+	assertError(t, ac1.Verify(pid) != nil, "the expired access must not be verified")
+
+	//an admin grants without the master key
+	checkError(t, ac0.Grant(pid1, RoleAdmin))
+	time.Sleep(time.Second * 10)
+	_, pub2, _ := generateKeyPair()
+	pid2 := PubKeyToStr(pub2)
+	checkError(t, ac1.Grant(pid2, RoleWrite))
+	checkError(t, ac1.Grant(pid, RoleWrite))
+	assertError(t, ac1.Grant(pid, RoleAdmin) != nil, "an admin must not grant RoleAdmin")
+	t.Log("admin grant done")
+	time.Sleep(time.Second * 10)
+
+	checkError(t, ac0.Verify(pid2), "the access granted by the admin must be verified")
+	assertError(t, ac0.Verify(pid) != nil, "an admin must not override the revocation by the master key")
+	checkError(t, ac0.Grant(pid, RoleWrite))
+	time.Sleep(time.Second * 10)
+
+	_, err = db0.Get(pid + "/aaa")
+	checkError(t, err)
+
+	//curated readers
+	checkError(t, ac0.Revoke(AnyAccess))
+	_, err = db0.Get(pid + "/aaa")
+	checkError(t, err, "the master key must be able to read")
+	_, err = db1.Get(pid + "/aaa")
+	checkError(t, err, "an admin must be able to read")
+	checkError(t, ac0.Revoke(pid1))
+	time.Sleep(time.Second * 10)
+
+	_, err = db1.Get(pid + "/aaa")
+	assertError(t, err != nil, "Get without RoleRead must be fail")
+	checkError(t, ac0.Grant(pid1, RoleRead))
+	time.Sleep(time.Second * 10)
+
+	v14, err := db1.Get(pid + "/aaa")
+	checkError(t, err)
+	t.Log("db1.Get:", string(v14))
+
 	db0.Close()
 	db1.Close()
 	time.Sleep(time.Second)
 	os.RemoveAll("ac")
 }
 
+func testDelegation(t *testing.T, hGen pv.HostGenerator, baiStr string) {
+	opts0 := &StoreOpts{}
+	db0 := newStore(t, hGen, "dl/da", "us", "updatableSignature", baiStr, opts0)
+	ac0 := newAccessStore(t, db0, PubKeyToStr(opts0.Pub))
+	t.Log("db0 generated")
+
+	opts1 := &StoreOpts{}
+	db1 := newStore(t, hGen, "dl/db", ac0.Address(), "updatableSignature", baiStr, opts1)
+	ac1 := db1.(IAccessStore)
+	pid1 := PubKeyToStr(opts1.Pub)
+	t.Log("db1 generated")
+
+	_, pub2, _ := generateKeyPair()
+	pid2 := PubKeyToStr(pub2)
+	assertError(t, ac1.Grant(pid2, RoleWrite) != nil, "Grant without any role must be fail")
+
+	expiry := time.Now().Add(time.Minute * 10)
+	checkError(t, ac0.GrantUntil(pid1, RoleRead|RoleWrite, expiry))
+	time.Sleep(time.Second * 10)
+
+	//the master key is not needed to onboard pid2
+	assertError(t, ac1.GrantUntil(pid2, RoleWrite, expiry.Add(time.Second)) != nil, "a delegation must not outlive its proof")
+	assertError(t, ac1.Grant(pid2, RoleWrite) != nil, "a delegation without expiry must not outlive its proof")
+	assertError(t, ac1.GrantUntil(pid2, RoleAdmin, expiry) != nil, "RoleAdmin must not be delegated")
+	checkError(t, ac1.GrantUntil(pid2, RoleWrite, expiry.Add(-time.Minute)))
+	checkError(t, ac1.VerifyRole(pid2, RoleWrite), "the delegated role must be verified")
+	assertError(t, ac1.VerifyRole(pid2, RoleAdmin) != nil, "a role which is not delegated must not be verified")
+	t.Log("delegation done")
+	time.Sleep(time.Second * 10)
+
+	checkError(t, ac0.VerifyRole(pid2, RoleWrite), "the delegated role must be replicated")
+	checkError(t, ac0.Revoke(pid1))
+	assertError(t, ac0.VerifyRole(pid2, RoleWrite) != nil, "the delegation from the revoked access must not be verified")
+	checkError(t, ac0.GrantUntil(pid1, RoleRead|RoleWrite, expiry))
+	assertError(t, ac0.VerifyRole(pid2, RoleWrite) != nil, "the delegation from a replaced grant must not be verified")
+	time.Sleep(time.Second * 10)
+
+	//a delegated grant only adds a role, i.e. it cannot take RoleRead of AnyAccess granted by the master key
+	checkError(t, ac1.GrantUntil(AnyAccess, 0, expiry.Add(-time.Minute)))
+	checkError(t, ac1.VerifyRole(AnyAccess, RoleRead), "a delegated grant must not narrow the grant by the master key")
+	t.Log("downgrade done")
+	time.Sleep(time.Second * 10)
+	checkError(t, ac0.VerifyRole(AnyAccess, RoleRead), "a delegated grant must not narrow the grant by the master key")
+
+	//a grant in the future is not valid
+	_, pub3, _ := generateKeyPair()
+	pid3 := PubKeyToStr(pub3)
+	st0 := ac0.(*accessStore)
+	tb, err := time.Now().Add(time.Hour).UTC().MarshalBinary()
+	checkError(t, err)
+	eb, err := time.Time{}.MarshalBinary()
+	checkError(t, err)
+	msd, err := st0.signAccess(&pb.Grant{
+		MasterKey: PubKeyToStr(st0.pub),
+		Access:    pid3,
+		Scope:     st0.storeName(),
+		Time:      tb,
+		Expiry:    eb,
+		Role:      uint32(RoleWrite),
+		Issuer:    st0.issuer,
+	})
+	checkError(t, err)
+	checkError(t, st0.IAccessBaseStore.Put(recordKey(st0.accessKey(pid3, false), tb), msd))
+	assertError(t, ac0.VerifyRole(pid3, RoleWrite) != nil, "a grant in the future must not be verified")
+
+	ac0.Close()
+	db1.Close()
+	time.Sleep(time.Second)
+	os.RemoveAll("dl")
+}
+
 func BaseTestAccessController(t *testing.T, hGen pv.HostGenerator) {
 	bstrp, err := pv.NewBootstrap(hGen)
 	checkError(t, err)
@@ -88,5 +237,7 @@ func BaseTestAccessController(t *testing.T, hGen pv.HostGenerator) {
 	testHashAccess(t, hGen, baiStr)
 	t.Log("===== signature access =====")
 	testSignatureAccess(t, hGen, baiStr)
+	t.Log("===== delegation =====")
+	testDelegation(t, hGen, baiStr)
 	t.Log("finished")
 }
@@ -0,0 +1,48 @@
+package crdtverse
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	pv "github.com/pilinsin/p2p-verse"
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
+)
+
+func TestClose(t *testing.T) {
+	lc := p2pversetest.NewLeakChecker("github.com/pilinsin/p2p-verse.", "github.com/pilinsin/p2p-verse/crdt.")
+	n := p2pversetest.NewNetwork()
+	defer n.Close()
+	hGen := n.HostGenerator()
+
+	bstrp, err := pv.NewBootstrap(hGen)
+	checkError(t, err)
+	bAddrInfo := bstrp.AddrInfo()
+	baiStr := pv.AddrInfoToString(bAddrInfo)
+
+	tl := time.Now().Add(time.Hour)
+	db0 := newStore(t, hGen, "cl/ca", "ud", "updatable", baiStr, &StoreOpts{TimeLimit: tl})
+	db1 := newStore(t, hGen, "cl/cb", db0.Address(), "updatable", baiStr)
+	checkError(t, db0.Put("aaa", []byte("meow meow ^.^")))
+	checkError(t, db0.Put("bbb", []byte("nyan nyan")))
+
+	//a query which is not read to the end must not keep the store
+	rs, err := db0.Query()
+	checkError(t, err)
+	<-rs.Next()
+
+	checkError(t, db0.Close())
+	checkError(t, db0.Close(), "Close must be idempotent")
+	checkError(t, db1.Close())
+	checkError(t, bstrp.Close())
+	_, ok := <-rs.Next()
+	for ok {
+		_, ok = <-rs.Next()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	checkError(t, lc.Wait(ctx))
+	os.RemoveAll("cl")
+}
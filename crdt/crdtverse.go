@@ -1,14 +1,13 @@
 package crdtverse
 
 import (
-	"fmt"
-
 	"context"
 	"encoding/base64"
 	"errors"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	proto "google.golang.org/protobuf/proto"
@@ -16,10 +15,10 @@ import (
 	ds "github.com/ipfs/go-datastore"
 	query "github.com/ipfs/go-datastore/query"
 	crdt "github.com/ipfs/go-ds-crdt"
-	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	pv "github.com/pilinsin/p2p-verse"
 	pb "github.com/pilinsin/p2p-verse/crdt/pb"
+	multierr "go.uber.org/multierr"
 )
 
 const (
@@ -29,6 +28,9 @@ const (
 
 var ErrAlreadyExist = errors.New("the key already exists")
 
+//the signed times of the other peers may be ahead of the local clock by maxClockSkew at most.
+const maxClockSkew = 5 * time.Minute
+
 func MakeAddress(name, pid string, salt []byte, timeLimits ...time.Time) string {
 	tl := time.Time{}
 	if len(timeLimits) > 0 {
@@ -54,36 +56,79 @@ func MakeAddress(name, pid string, salt []byte, timeLimits ...time.Time) string
 
 type crdtVerse struct {
 	hGenerator pv.HostGenerator
+	node       *pv.Node
 	dirPath    string
 	save       bool
 	bootstraps []peer.AddrInfo
+	discs      []pv.DiscovererGenerator
+	logger     pv.Logger
 }
 
+//each store opened from the verse has its own host and DHT.
 func NewVerse(hGen pv.HostGenerator, dir string, save bool, bootstraps ...peer.AddrInfo) *crdtVerse {
-	return &crdtVerse{hGen, dir, save, bootstraps}
+	return &crdtVerse{hGen, nil, dir, save, bootstraps, nil, nil}
 }
 
-type baseStore struct {
-	ctx       context.Context
-	cancel    func()
-	dsCancel  func()
-	name      string
-	timeLimit time.Time
-	inTime    bool
-	h         host.Host
-	dht       *pv.DiscoveryDHT
-	dStore    ds.Datastore
-	dt        *crdt.Datastore
+//the host of each store also discovers the replicas with discs, e.g. pv.MdnsGenerator.
+func NewVerseWithDiscoverers(hGen pv.HostGenerator, dir string, save bool, discs []pv.DiscovererGenerator, bootstraps ...peer.AddrInfo) *crdtVerse {
+	return &crdtVerse{hGen, nil, dir, save, bootstraps, discs, nil}
+}
 
-	cv *crdtVerse
+//all stores opened from the verse share the host, DHT, GossipSub and ipfs-lite peer of node.
+//Discoverers are added to node by node.AddDiscoverers.
+func NewVerseFromNode(node *pv.Node, dir string, save bool) *crdtVerse {
+	return &crdtVerse{nil, node, dir, save, node.Bootstraps(), nil, nil}
 }
 
-func (cv *crdtVerse) initCRDT(name string, v iValidator, st *baseStore) error {
-	h, err := cv.hGenerator()
-	if err != nil {
-		return err
+//WithLogger sets the Logger of the stores opened from the verse, e.g.
+//	NewVerse(hGen, dir, save, bootstraps...).WithLogger(logger)
+//StoreOpts.Logger takes precedence over it.
+func (cv *crdtVerse) WithLogger(l pv.Logger) *crdtVerse {
+	cv.logger = l
+	return cv
+}
+
+//the messages of a store have its name and mode.
+func (cv *crdtVerse) storeLogger(name, mode string, opts ...*StoreOpts) pv.Logger {
+	var logger pv.Logger
+	switch {
+	case len(opts) > 0 && opts[0] != nil && opts[0].Logger != nil:
+		logger = opts[0].Logger
+	case cv.logger != nil:
+		logger = cv.logger
+	case cv.node != nil:
+		logger = cv.node.Logger()
+	default:
+		logger = pv.DefaultLogger()
 	}
+	return logger.With(pv.F("store", name), pv.F("mode", mode))
+}
+
+type baseStore struct {
+	ctx        context.Context
+	cancel     func()
+	dsCancel   func()
+	name       string
+	salt       []byte
+	timeLimit  time.Time
+	inTime     bool
+	node       *pv.Node
+	ownNode    bool
+	mode       string
+	logger     pv.Logger
+	unregister func()
+	dStore     ds.Datastore
+	bc         *pubSubBroadcaster
+	dt         *crdt.Datastore
+	wMutex     sync.Mutex
+	wg         sync.WaitGroup
+	closeOnce  sync.Once
+	closeErr   error
+
+	cv *crdtVerse
+}
 
+func (cv *crdtVerse) initCRDT(ctx context.Context, name, mode string, v iValidator, st *baseStore, opts ...*StoreOpts) error {
 	dirAddr := filepath.Join(cv.dirPath, name)
 	if err := os.MkdirAll(dirAddr, 0700); err != nil {
 		return err
@@ -93,27 +138,37 @@ func (cv *crdtVerse) initCRDT(name string, v iValidator, st *baseStore) error {
 		dsCancel = func() { os.RemoveAll(dirAddr) }
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	sp, err := cv.setupStore(ctx, h, name, v)
+	stCtx, cancel := context.WithCancel(context.Background())
+	logger := cv.storeLogger(name, mode, opts...)
+	sp, err := cv.setupStore(ctx, stCtx, name, v, logger)
 	if err != nil {
 		cancel()
 		return err
 	}
 
-	st.ctx = ctx
+	st.ctx = stCtx
 	st.cancel = cancel
 	st.dsCancel = dsCancel
 	st.name = name
 	st.inTime = true
-	st.h = h
-	st.dht = sp.dht
+	st.node = sp.node
+	st.ownNode = sp.ownNode
+	st.mode = mode
+	st.logger = logger.With(pv.F("peer", sp.node.Host().ID()))
 	st.dStore = sp.dStore
+	st.bc = sp.bc
 	st.dt = sp.dt
 	st.cv = cv
+	st.unregister = pv.DefaultMetrics().Register(pv.CollectorFunc(st.collect))
 	return nil
 }
 
 func (cv *crdtVerse) NewStore(name, mode string, opts ...*StoreOpts) (IStore, error) {
+	return cv.NewStoreContext(context.Background(), name, mode, opts...)
+}
+
+//ctx bounds the setup and the initial sync of the store, not its lifetime.
+func (cv *crdtVerse) NewStoreContext(ctx context.Context, name, mode string, opts ...*StoreOpts) (IStore, error) {
 	opt := &StoreOpts{}
 	if len(opts) > 0 {
 		opt = opts[0]
@@ -122,11 +177,11 @@ func (cv *crdtVerse) NewStore(name, mode string, opts ...*StoreOpts) (IStore, er
 	var s IStore
 	stName, salt, pid, tl, err := parseAddress(name)
 	if err != nil {
-		s, err = cv.newStore(name, mode, opt)
+		s, err = cv.newStore(ctx, name, mode, opt)
 	} else {
 		opt.Salt = salt
 		opt.TimeLimit = tl
-		s, err = cv.loadStore(stName, mode, opt)
+		s, err = cv.loadStore(ctx, stName, mode, opt)
 	}
 	if err != nil && s == nil {
 		return nil, err
@@ -140,6 +195,7 @@ func (cv *crdtVerse) NewStore(name, mode string, opts ...*StoreOpts) (IStore, er
 	}
 
 	s.autoSync()
+	s.autoDiscover(opt.TargetPeers)
 	return s, err
 }
 func parseAddress(addr string) (string, []byte, string, time.Time, error) {
@@ -162,47 +218,48 @@ func parseAddress(addr string) (string, []byte, string, time.Time, error) {
 	}
 	return baseAddress.GetName(), baseAddress.GetSalt(), baseAddress.GetPid(), tl, nil
 }
-func (cv *crdtVerse) selectNewStore(name, mode string, opts ...*StoreOpts) (IStore, error) {
+func (cv *crdtVerse) selectNewStore(ctx context.Context, name, mode string, opts ...*StoreOpts) (IStore, error) {
 	switch mode {
 	case "updatable":
-		return cv.NewUpdatableStore(name, opts...)
+		return cv.newUpdatableStore(ctx, name, opts...)
 	case "signature":
-		return cv.NewSignatureStore(name, opts...)
+		return cv.newSignatureStore(ctx, name, opts...)
 	case "updatableSignature":
-		return cv.NewUpdatableSignatureStore(name, opts...)
+		return cv.newUpdatableSignatureStore(ctx, name, opts...)
 	case "hash":
-		return cv.NewHashStore(name, opts...)
+		return cv.newHashStore(ctx, name, opts...)
 	default:
-		return cv.NewLogStore(name, opts...)
+		return cv.newLogStore(ctx, name, opts...)
 	}
 }
-func (cv *crdtVerse) newStore(name, mode string, opt *StoreOpts) (IStore, error) {
-	s, err := cv.selectNewStore(name, mode, opt)
+func (cv *crdtVerse) newStore(ctx context.Context, name, mode string, opt *StoreOpts) (IStore, error) {
+	s, err := cv.selectNewStore(ctx, name, mode, opt)
 	if err != nil {
 		return nil, err
 	}
-	if err := s.initPut(); err != nil {
+	if err := s.initPut(ctx); err != nil {
 		s.Close()
 		return nil, err
 	}
 
 	return s, nil
 }
-func (cv *crdtVerse) loadStore(name, mode string, opt *StoreOpts) (IStore, error) {
+func (cv *crdtVerse) loadStore(ctx context.Context, name, mode string, opt *StoreOpts) (IStore, error) {
+	logger := cv.storeLogger(name, mode, opt)
 	N := 3
 	for i := 0; i < N; i++ {
-		s, err := cv.selectNewStore(name, mode, opt)
+		s, err := cv.selectNewStore(ctx, name, mode, opt)
 		if err != nil {
 			if strings.HasPrefix(err.Error(), dirLock) {
-				fmt.Println("dirLock error, now reloading...")
+				logger.Warn("directory lock error, reloading", pv.F("attempt", i+1))
 				continue
 			}
 			return nil, err
 		}
 
-		if err := cv.loadCheck(s); err != nil {
+		if err := cv.loadCheck(ctx, s); err != nil {
 			if strings.HasPrefix(err.Error(), timeout) {
-				fmt.Println("timeout error, now reloading...")
+				logger.Warn("sync timeout, reloading", pv.F("attempt", i+1))
 				continue
 			}
 			return nil, err
@@ -211,28 +268,31 @@ func (cv *crdtVerse) loadStore(name, mode string, opt *StoreOpts) (IStore, error
 		return s, nil
 	}
 
-	s, err := cv.selectNewStore(name, mode, opt)
+	s, err := cv.selectNewStore(ctx, name, mode, opt)
 	if err != nil {
 		return nil, err
 	}
-	if err := s.initPut(); err != nil {
+	if err := s.initPut(ctx); err != nil {
 		s.Close()
 		return nil, err
 	}
 	return s, errors.New("load failed")
 }
-func (cv *crdtVerse) loadCheck(s IStore) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+func (cv *crdtVerse) loadCheck(ctx context.Context, s IStore) error {
+	tCtx, cancel := context.WithTimeout(ctx, time.Second*30)
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 	defer cancel()
 	for {
 		select {
-		case <-ctx.Done():
+		case <-tCtx.Done():
 			s.Cancel()
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			return errors.New("load error: sync timeout (store)")
 		case <-ticker.C:
-			if err := s.Sync(); err != nil {
+			if err := s.SyncContext(tCtx); err != nil {
 				s.Close()
 				return err
 			}
@@ -245,6 +305,12 @@ func (cv *crdtVerse) loadCheck(s IStore) error {
 
 type iValidator interface {
 	Validate(string, []byte) bool
+	isInTime() bool
+	storeAddress() string
+	//deletable reports whether the deletion records signed by the owners of the keys are accepted.
+	deletable() bool
+	//ahead reports whether the time of key is ahead of the local clock, i.e. the value is ignored until then.
+	ahead(string) bool
 }
 type baseValidator struct {
 	s IStore
@@ -256,53 +322,150 @@ func newBaseValidator(s IStore) iValidator {
 func (v *baseValidator) Validate(key string, val []byte) bool {
 	return v.s.isInTime()
 }
+func (v *baseValidator) isInTime() bool {
+	return v.s.isInTime()
+}
+func (v *baseValidator) storeAddress() string {
+	return v.s.Address()
+}
+func (v *baseValidator) deletable() bool       { return false }
+func (v *baseValidator) ahead(key string) bool { return false }
 
 type IStore interface {
-	Cancel()
-	Close()
+	Cancel() error
+	Close() error
 	Address() string
 	AddrInfo() peer.AddrInfo
+	storeContext() context.Context
+	storeName() string
 	isInTime() bool
 	setTimeLimit()
+	autoDiscover(int)
 	Sync() error
+	SyncContext(context.Context) error
 	autoSync()
 	Put(string, []byte) error
+	PutContext(context.Context, string, []byte) error
 	Get(string) ([]byte, error)
+	GetContext(context.Context, string) ([]byte, error)
 	GetSize(string) (int, error)
 	Has(string) (bool, error)
+	HasContext(context.Context, string) (bool, error)
 	Query(...query.Query) (query.Results, error)
-	initPut() error
+	QueryContext(context.Context, ...query.Query) (query.Results, error)
+	initPut(context.Context) error
 	loadCheck() bool
 }
 
 type StoreOpts struct {
+	//the salt of the address, which is required by a hash store and optional for a store of signatures
 	Salt      []byte
 	Priv      IPrivKey
 	Pub       IPubKey
 	TimeLimit time.Time
+	//the number of topic peers to keep discovering for (default: 3)
+	TargetPeers int
+	//everyone has RoleRead in an access store made by NewAccessStore unless PrivateRead,
+	//and also RoleWrite if PublicWrite.
+	//PrivateRead is advisory since the values are replicated to every peer of the store.
+	PrivateRead bool
+	PublicWrite bool
+	//the values signed in the legacy format, whose signatures do not cover the key and the store,
+	//are accepted from the other peers of a store of signatures during the transition to the current format,
+	//i.e. until all the writers of the store have run MigrateSignatures.
+	//RejectLegacySignatures ends the transition for the store, and such values are ignored then.
+	RejectLegacySignatures bool
+	//the Logger of the store (default: the Logger of the verse)
+	Logger pv.Logger
 }
 
-func (s *baseStore) Cancel() {
-	s.cancel()
-	s.dt.Close()
-	s.dStore.Close()
-	s.dht.Close()
-	s.h.Close()
+const defaultTargetPeers = 3
+
+//Cancel stops the goroutines of the store and waits for them,
+//and then closes the topic, the crdt, the node if owned and the datastore in order.
+//The directory of the store is kept. Cancel returns the same error every time.
+func (s *baseStore) Cancel() error {
+	s.closeOnce.Do(func() {
+		s.unregister()
+		s.wMutex.Lock()
+		s.cancel()
+		s.wMutex.Unlock()
+		s.node.DHT().StopDiscovery(storeKeyword(s.name))
+		s.wg.Wait()
+
+		err := s.bc.close()
+		err = multierr.Append(err, s.dt.Close())
+		err = multierr.Append(err, s.node.PubSub().UnregisterTopicValidator(s.name))
+		if s.ownNode {
+			err = multierr.Append(err, s.node.Close())
+		}
+		s.closeErr = multierr.Append(err, s.dStore.Close())
+	})
+	return s.closeErr
 }
-func (s *baseStore) Close() {
+
+//Close also removes the directory of the store unless the verse saves it.
+func (s *baseStore) Close() error {
 	if s == nil {
-		return
+		return nil
 	}
-	s.Cancel()
+	err := s.Cancel()
 	s.dsCancel()
+	return err
+}
+
+//goFunc runs f in a goroutine which Cancel waits for.
+//f is not run and false is returned after the store is closed.
+func (s *baseStore) goFunc(f func()) bool {
+	s.wMutex.Lock()
+	defer s.wMutex.Unlock()
+	if s.ctx.Err() != nil {
+		return false
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		f()
+	}()
+	return true
+}
+
+//forward sends the results of rs converted by conv until ctx is done or the store is closed.
+//A result is dropped if conv returns false. rs is closed when the forwarding ends.
+func (s *baseStore) forward(ctx context.Context, rs query.Results, conv func(query.Result) (query.Result, bool)) query.Results {
+	ch := make(chan query.Result)
+	fwd := func() {
+		defer close(ch)
+		defer rs.Close()
+		for r := range rs.Next() {
+			r, ok := conv(r)
+			if !ok {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.ctx.Done():
+				return
+			case ch <- r:
+			}
+		}
+	}
+	if !s.goFunc(fwd) {
+		close(ch)
+		rs.Close()
+	}
+	return query.ResultsWithChan(query.Query{}, ch)
 }
 func (s *baseStore) Address() string {
-	return MakeAddress(s.name, "", nil, s.timeLimit)
+	return MakeAddress(s.name, "", s.salt, s.timeLimit)
 }
 func (s *baseStore) AddrInfo() peer.AddrInfo {
-	return pv.HostToAddrInfo(s.h)
+	return s.node.AddrInfo()
 }
-func (s *baseStore) isInTime() bool { return s.inTime }
+func (s *baseStore) storeContext() context.Context { return s.ctx }
+func (s *baseStore) storeName() string             { return s.name }
+func (s *baseStore) isInTime() bool                { return s.inTime }
 func (s *baseStore) setTimeLimit() {
 	if !s.inTime {
 		return
@@ -314,34 +477,69 @@ func (s *baseStore) setTimeLimit() {
 		s.inTime = false
 		return
 	}
-	go func() {
+	s.goFunc(func() {
 		tlCtx, tlCancel := context.WithDeadline(context.Background(), s.timeLimit)
 		defer tlCancel()
 		select {
 		case <-s.ctx.Done():
 			return
 		case <-tlCtx.Done():
-			s.dt.Sync(s.ctx, ds.NewKey("/"))
+			s.sync(s.ctx)
 			s.inTime = false
 		}
-	}()
+	})
 }
 
 func (s *baseStore) Sync() error {
+	return s.SyncContext(s.ctx)
+}
+func (s *baseStore) SyncContext(ctx context.Context) error {
 	if !s.inTime {
 		return nil
 	}
-	return s.dt.Sync(s.ctx, ds.NewKey("/"))
+	return s.sync(ctx)
+}
+
+//sync records the duration of a sync of the whole store.
+func (s *baseStore) sync(ctx context.Context) error {
+	start := time.Now()
+	err := s.dt.Sync(ctx, ds.NewKey("/"))
+	pv.DefaultMetrics().Observe("p2pverse_store_sync_seconds", time.Since(start).Seconds(), "store", s.name)
+	return err
+}
+
+//collect returns the gauges of the store at the moment.
+func (s *baseStore) collect() []pv.Sample {
+	if s.ctx.Err() != nil {
+		return nil
+	}
+	peers := len(s.node.PubSub().ListPeers(s.name))
+	samples := []pv.Sample{
+		{Name: "p2pverse_store_connected_peers", Labels: []string{"store", s.name}, Value: float64(peers)},
+	}
+
+	//the DAG heads are kept under /<name>/h by go-ds-crdt
+	prefix := ds.NewKey(s.name).ChildString("h").String()
+	rs, err := s.dStore.Query(s.ctx, query.Query{Prefix: prefix, KeysOnly: true})
+	if err != nil {
+		return samples
+	}
+	entries, err := rs.Rest()
+	if err != nil {
+		return samples
+	}
+	return append(samples, pv.Sample{Name: "p2pverse_store_dag_heads", Labels: []string{"store", s.name}, Value: float64(len(entries))})
 }
 func (s *baseStore) autoSync() {
 	if !s.inTime {
 		return
 	}
-	if err := s.dt.Sync(s.ctx, ds.NewKey("/")); err != nil {
+	if err := s.sync(s.ctx); err != nil {
+		s.logger.Warn("auto sync stopped", pv.F("error", err))
 		return
 	}
 
-	go func() {
+	s.goFunc(func() {
 		ticker := time.NewTicker(time.Second * 5)
 		defer ticker.Stop()
 		for {
@@ -352,22 +550,54 @@ func (s *baseStore) autoSync() {
 				if !s.inTime {
 					return
 				}
-				if err := s.dt.Sync(s.ctx, ds.NewKey("/")); err != nil {
+				if err := s.sync(s.ctx); err != nil {
+					if s.ctx.Err() == nil {
+						s.logger.Warn("auto sync stopped", pv.F("error", err))
+					}
 					return
 				}
 			}
 		}
-	}()
+	})
+}
+
+//autoDiscover keeps searching the replicas of the store while its topic has less than targetPeers peers.
+func (s *baseStore) autoDiscover(targetPeers int) {
+	s.node.DHT().StartDiscovery(storeKeyword(s.name), s.discoveryOpts(targetPeers))
+}
+func (s *baseStore) discoveryOpts(targetPeers int) *pv.DiscoveryOpts {
+	if targetPeers <= 0 {
+		targetPeers = defaultTargetPeers
+	}
+
+	gossip := s.node.PubSub()
+	return &pv.DiscoveryOpts{
+		Low:         targetPeers,
+		PeerCounter: func() int { return len(gossip.ListPeers(s.name)) },
+	}
 }
 func (s *baseStore) Put(key string, val []byte) error {
-	exist, err := s.Has(key)
+	return s.PutContext(s.ctx, key, val)
+}
+func (s *baseStore) PutContext(ctx context.Context, key string, val []byte) error {
+	if isTombstoneKey(key) {
+		return errors.New("reserved key")
+	}
+	exist, err := s.HasContext(ctx, key)
 	if exist && err == nil {
 		return ErrAlreadyExist
 	}
-	return s.dt.Put(s.ctx, ds.NewKey(key), val)
+	if err := s.dt.Put(ctx, ds.NewKey(key), val); err != nil {
+		return err
+	}
+	pv.DefaultMetrics().Inc("p2pverse_store_puts_total", "store", s.name, "mode", s.mode)
+	return nil
 }
 func (s *baseStore) Get(key string) ([]byte, error) {
-	b, err := s.dt.Get(s.ctx, ds.NewKey(key))
+	return s.GetContext(s.ctx, key)
+}
+func (s *baseStore) GetContext(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.dt.Get(ctx, ds.NewKey(key))
 	if err != nil {
 		return nil, err
 	}
@@ -380,20 +610,27 @@ func (s *baseStore) GetSize(key string) (int, error) {
 	return s.dt.GetSize(s.ctx, ds.NewKey(key))
 }
 func (s *baseStore) Has(key string) (bool, error) {
-	return s.dt.Has(s.ctx, ds.NewKey(key))
+	return s.HasContext(s.ctx, key)
+}
+func (s *baseStore) HasContext(ctx context.Context, key string) (bool, error) {
+	return s.dt.Has(ctx, ds.NewKey(key))
 }
 func (s *baseStore) Query(qs ...query.Query) (query.Results, error) {
+	return s.QueryContext(s.ctx, qs...)
+}
+func (s *baseStore) QueryContext(ctx context.Context, qs ...query.Query) (query.Results, error) {
 	var q query.Query
 	if len(qs) == 0 {
 		q = query.Query{}
 	} else {
 		q = qs[0]
 	}
-	return s.dt.Query(s.ctx, q)
+	q.Filters = append([]query.Filter{tombstoneFilter{}}, q.Filters...)
+	return s.dt.Query(ctx, q)
 }
 
-func (s *baseStore) initPut() error {
-	return s.Put(s.name, []byte(s.name))
+func (s *baseStore) initPut(ctx context.Context) error {
+	return s.PutContext(ctx, s.name, []byte(s.name))
 }
 func (s *baseStore) loadCheck() bool {
 	if !s.inTime {
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	ds "github.com/ipfs/go-datastore"
 	query "github.com/ipfs/go-datastore/query"
 	pv "github.com/pilinsin/p2p-verse"
 )
@@ -57,6 +58,19 @@ func BaseTestLogStore(t *testing.T, hGen pv.HostGenerator) {
 		t.Log(string(res.Value))
 	}
 
+	//a later write of an existing key does not replace the first value on any replica
+	st0 := db0.(*logStore)
+	checkError(t, st0.dt.Put(st0.ctx, ds.NewKey("aaa"), []byte("meow meow 3 ^.^")))
+	t.Log("overwrite done")
+	time.Sleep(time.Second * 10)
+
+	v13, err := db0.Get("aaa")
+	checkError(t, err)
+	assertError(t, string(v13) == "meow meow ^.^", "the first value must be kept")
+	v14, err := db1.Get("aaa")
+	checkError(t, err)
+	assertError(t, string(v14) == "meow meow ^.^", "the first value must be replicated")
+
 	db0.Close()
 	db1.Close()
 	time.Sleep(time.Second)
@@ -0,0 +1,120 @@
+package crdtverse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	pb "github.com/pilinsin/p2p-verse/crdt/pb"
+	proto "google.golang.org/protobuf/proto"
+)
+
+//a grantee can delegate a narrower grant to another access without the master key.
+//the delegated grant has the signed grant of its issuer as the proof,
+//which has the proof of its own issuer in turn, back to a grant by the master key or an admin.
+//every grant in the chain must be in effect, i.e. neither replaced, expired nor revoked,
+//so that revoking an access also revokes the grants delegated from it.
+const maxDelegationDepth = 8
+
+//issuerProof checks that the key pair of the store can issue grant,
+//and returns the signed grant of the key pair as the proof if grant is delegated.
+func (s *accessStore) issuerProof(ctx context.Context, grant *pb.Grant) ([]byte, error) {
+	role := Role(grant.GetRole())
+	err := s.checkIssuer(ctx, role)
+	if err == nil {
+		return nil, nil
+	}
+	if role&RoleAdmin != 0 {
+		return nil, err
+	}
+
+	grants, err := s.validGrants(ctx, s.issuer, true, maxDelegationDepth)
+	if err != nil {
+		return nil, err
+	}
+	for _, own := range grants {
+		if delegable(own.grant, grant) {
+			return proto.Marshal(own.sd)
+		}
+	}
+	return nil, errors.New("no permission to delegate the role")
+}
+
+//validProof verifies that the proof of grant delegated by its issuer is a grant of the issuer in effect,
+//so that a proof which is replaced by a later grant of the issuer is not valid.
+func (s *accessStore) validProof(ctx context.Context, grant *pb.Grant, depth int) bool {
+	if depth <= 0 || len(grant.GetProof()) == 0 {
+		return false
+	}
+	sd := &pb.SignatureData{}
+	if err := proto.Unmarshal(grant.GetProof(), sd); err != nil {
+		return false
+	}
+	parent := &pb.Grant{}
+	if err := proto.Unmarshal(sd.GetValue(), parent); err != nil {
+		return false
+	}
+	if !delegable(parent, grant) {
+		return false
+	}
+
+	grants, err := s.validGrants(ctx, grant.GetIssuer(), true, depth-1)
+	if err != nil {
+		return false
+	}
+	for _, g := range grants {
+		if bytes.Equal(g.sd.GetValue(), sd.GetValue()) && bytes.Equal(g.sd.GetSign(), sd.GetSign()) {
+			return true
+		}
+	}
+	return false
+}
+
+//delegable reports whether child is narrower than parent,
+//i.e. a part of the role except RoleAdmin, issued after parent and expired not later than parent.
+func delegable(parent, child *pb.Grant) bool {
+	pRole := Role(parent.GetRole())
+	if pRole&RoleAdmin != 0 {
+		pRole |= RoleRead | RoleWrite
+	}
+	cRole := Role(child.GetRole())
+	if cRole&RoleAdmin != 0 || cRole&^pRole != 0 {
+		return false
+	}
+
+	pt, pe, ok := grantTimes(parent)
+	if !ok || isExpired(pe) {
+		return false
+	}
+	ct, ce, ok := grantTimes(child)
+	if !ok || ct.Before(pt) {
+		return false
+	}
+	return pe.IsZero() || (!ce.IsZero() && !ce.After(pe))
+}
+
+//grantTimes returns the time and the expiry of grant.
+//a grant whose time is in the future is skipped on the reads until the local clock reaches it,
+//i.e. it is ignored rather than rejected, since it is not validated when it is replicated.
+func grantTimes(grant *pb.Grant) (time.Time, time.Time, bool) {
+	t := time.Time{}
+	if err := t.UnmarshalBinary(grant.GetTime()); err != nil || isFuture(t) {
+		return time.Time{}, time.Time{}, false
+	}
+	e := time.Time{}
+	if err := e.UnmarshalBinary(grant.GetExpiry()); err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return t, e, true
+}
+
+//a signed time may be ahead of the local clock by maxClockSkew at most.
+func isFuture(t time.Time) bool {
+	return t.After(time.Now().Add(maxClockSkew))
+}
+
+//a zero expiry never expires.
+func isExpired(expiry time.Time) bool {
+	return !expiry.IsZero() && !time.Now().Before(expiry)
+}
@@ -0,0 +1,88 @@
+package crdtverse
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pv "github.com/pilinsin/p2p-verse"
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
+)
+
+func hasPeer(pids []peer.ID, pid peer.ID) bool {
+	for _, p := range pids {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRendezvous(t *testing.T) {
+	n := p2pversetest.NewNetwork()
+	defer n.Close()
+	hGen := n.HostGenerator()
+
+	bstrp, err := pv.NewBootstrap(hGen)
+	checkError(t, err)
+	defer bstrp.Close()
+	bAddrInfo := bstrp.AddrInfo()
+
+	node0, err := pv.NewNode(hGen, "rv/n0", false, bAddrInfo)
+	checkError(t, err)
+	node1, err := pv.NewNode(hGen, "rv/n1", false, bAddrInfo)
+	checkError(t, err)
+	node2, err := pv.NewNode(hGen, "rv/n2", false, bAddrInfo)
+	checkError(t, err)
+	cv0 := NewVerseFromNode(node0, "rv/ra", false)
+	cv1 := NewVerseFromNode(node1, "rv/rb", false)
+	cv2 := NewVerseFromNode(node2, "rv/rc", false)
+
+	db0, err := cv0.NewStore("rva", "log", &StoreOpts{TargetPeers: 5})
+	checkError(t, err)
+	db1, err := cv1.NewStore(db0.Address(), "log")
+	checkError(t, err)
+	db2, err := cv2.NewStore("rvb", "log")
+	checkError(t, err)
+	t.Log("stores generated")
+
+	//the replicas of a store meet on the rendezvous of the store only
+	name0, _, _, _, err := parseAddress(db0.Address())
+	checkError(t, err)
+	name2, _, _, _, err := parseAddress(db2.Address())
+	checkError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = p2pversetest.WaitFor(ctx, func() bool {
+		return hasPeer(node1.DHT().KeywordPeers(storeKeyword(name0)), node0.Host().ID())
+	})
+	checkError(t, err, "the replicas of a store must discover each other")
+	for _, node := range []*pv.Node{node0, node1} {
+		pids := node.DHT().KeywordPeers(storeKeyword(name0))
+		assertError(t, !hasPeer(pids, node2.Host().ID()), "a replica of another store must not be discovered")
+	}
+	pids := node2.DHT().KeywordPeers(storeKeyword(name2))
+	assertError(t, !hasPeer(pids, node0.Host().ID()), "a replica of another store must not be discovered")
+	assertError(t, !hasPeer(pids, node1.Host().ID()), "a replica of another store must not be discovered")
+
+	//the discovery of a store keeps TargetPeers peers of its topic
+	st0 := db0.(*logStore).baseStore
+	assertError(t, st0.discoveryOpts(5).Low == 5, "TargetPeers must be the low watermark")
+	assertError(t, st0.discoveryOpts(0).Low == defaultTargetPeers, "the default TargetPeers must be the low watermark")
+	err = p2pversetest.WaitFor(ctx, func() bool {
+		return st0.discoveryOpts(5).PeerCounter() == 1
+	})
+	checkError(t, err, "the peers of the topic must be counted")
+
+	db0.Close()
+	db1.Close()
+	db2.Close()
+	node0.Close()
+	node1.Close()
+	node2.Close()
+	time.Sleep(time.Second)
+	os.RemoveAll("rv")
+	t.Log("finished")
+}
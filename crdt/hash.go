@@ -1,6 +1,7 @@
 package crdtverse
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"strings"
@@ -57,8 +58,11 @@ type hashStore struct {
 }
 
 func (cv *crdtVerse) NewHashStore(name string, opts ...*StoreOpts) (IStore, error) {
+	return cv.newHashStore(context.Background(), name, opts...)
+}
+func (cv *crdtVerse) newHashStore(ctx context.Context, name string, opts ...*StoreOpts) (IStore, error) {
 	st := &baseStore{}
-	if err := cv.initCRDT(name, newHashValidator(st), st); err != nil {
+	if err := cv.initCRDT(ctx, name, "hash", newHashValidator(st), st, opts...); err != nil {
 		return nil, err
 	}
 
@@ -73,6 +77,9 @@ func (s *hashStore) Address() string {
 }
 
 func (s *hashStore) Put(bHashStr string, val []byte) error {
+	return s.PutContext(s.ctx, bHashStr, val)
+}
+func (s *hashStore) PutContext(ctx context.Context, bHashStr string, val []byte) error {
 	key := MakeHashKey(bHashStr, s.salt)
 
 	hd := &pb.HashData{
@@ -84,10 +91,10 @@ func (s *hashStore) Put(bHashStr string, val []byte) error {
 	if err != nil {
 		return err
 	}
-	return s.baseStore.Put(key, m)
+	return s.baseStore.PutContext(ctx, key, m)
 }
-func (s *hashStore) get(key string) ([]byte, error) {
-	m, err := s.baseStore.Get(key)
+func (s *hashStore) get(ctx context.Context, key string) ([]byte, error) {
+	m, err := s.baseStore.GetContext(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -98,13 +105,16 @@ func (s *hashStore) get(key string) ([]byte, error) {
 	return hd.GetValue(), nil
 }
 func (s *hashStore) Get(key string) ([]byte, error) {
-	data, err := s.get(key)
+	return s.GetContext(s.ctx, key)
+}
+func (s *hashStore) GetContext(ctx context.Context, key string) ([]byte, error) {
+	data, err := s.get(ctx, key)
 	if err == nil {
 		return data, nil
 	}
 
 	key = MakeHashKey(key, s.salt)
-	return s.get(key)
+	return s.get(ctx, key)
 }
 func (s *hashStore) GetSize(key string) (int, error) {
 	val, err := s.Get(key)
@@ -114,15 +124,21 @@ func (s *hashStore) GetSize(key string) (int, error) {
 	return len(val), nil
 }
 func (s *hashStore) Has(key string) (bool, error) {
-	ok, err := s.baseStore.Has(key)
+	return s.HasContext(s.ctx, key)
+}
+func (s *hashStore) HasContext(ctx context.Context, key string) (bool, error) {
+	ok, err := s.baseStore.HasContext(ctx, key)
 	if ok && err == nil {
 		return true, nil
 	}
 
 	key = MakeHashKey(key, s.salt)
-	return s.baseStore.Has(key)
+	return s.baseStore.HasContext(ctx, key)
 }
 func (s *hashStore) Query(qs ...query.Query) (query.Results, error) {
+	return s.QueryContext(s.ctx, qs...)
+}
+func (s *hashStore) QueryContext(ctx context.Context, qs ...query.Query) (query.Results, error) {
 	var q query.Query
 	if len(qs) == 0 {
 		q = query.Query{}
@@ -130,7 +146,7 @@ func (s *hashStore) Query(qs ...query.Query) (query.Results, error) {
 		q = qs[0]
 	}
 
-	rs, err := s.baseStore.Query(q)
+	rs, err := s.baseStore.QueryContext(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -138,20 +154,15 @@ func (s *hashStore) Query(qs ...query.Query) (query.Results, error) {
 		return rs, nil
 	}
 
-	ch := make(chan query.Result)
-	go func() {
-		defer close(ch)
-		for r := range rs.Next() {
-			hd := &pb.HashData{}
-			if err := proto.Unmarshal(r.Value, hd); err != nil {
-				continue
-			}
-
-			r.Value = hd.GetValue()
-			ch <- r
+	return s.forward(ctx, rs, func(r query.Result) (query.Result, bool) {
+		hd := &pb.HashData{}
+		if err := proto.Unmarshal(r.Value, hd); err != nil {
+			return r, false
 		}
-	}()
-	return query.ResultsWithChan(query.Query{}, ch), nil
+
+		r.Value = hd.GetValue()
+		return r, true
+	}), nil
 }
 
 func (s *hashStore) accessFromKey(key string) string {
@@ -160,33 +171,31 @@ func (s *hashStore) accessFromKey(key string) string {
 func (s *hashStore) putKey(key string) string {
 	return MakeHashKey(key, s.salt)
 }
-func (s *hashStore) acQuery(acKey string) (query.Results, error) {
-	key := MakeHashKey(acKey, s.salt)
-	rs, err := s.baseStore.Query(query.Query{
-		Filters: []query.Filter{KeyMatchFilter{Key: key}},
-	})
+
+//the records of acKey are put at <acKey>/<time>, whose hash keys have no common prefix,
+//so that they are found by the base hashes.
+func (s *hashStore) acQuery(ctx context.Context, acKey string) (query.Results, error) {
+	rs, err := s.baseStore.QueryContext(ctx, query.Query{})
 	if err != nil {
 		return nil, err
 	}
 
-	ch := make(chan query.Result)
-	go func() {
-		defer close(ch)
-		for r := range rs.Next() {
-			hd := &pb.HashData{}
-			if err := proto.Unmarshal(r.Value, hd); err != nil {
-				continue
-			}
-
-			r.Key = hd.GetBaseHash()
-			r.Value = hd.GetValue()
-			ch <- r
+	return s.forward(ctx, rs, func(r query.Result) (query.Result, bool) {
+		hd := &pb.HashData{}
+		if err := proto.Unmarshal(r.Value, hd); err != nil {
+			return r, false
+		}
+		if hd.GetBaseHash() != acKey && !strings.HasPrefix(hd.GetBaseHash(), acKey+"/") {
+			return r, false
 		}
-	}()
-	return query.ResultsWithChan(query.Query{}, ch), nil
+
+		r.Key = hd.GetBaseHash()
+		r.Value = hd.GetValue()
+		return r, true
+	}), nil
 }
 
-func (s *hashStore) initPut() error {
+func (s *hashStore) initPut(ctx context.Context) error {
 	key := MakeHashKey(s.name, s.salt)
 
 	hd := &pb.HashData{
@@ -198,7 +207,7 @@ func (s *hashStore) initPut() error {
 	if err != nil {
 		return err
 	}
-	return s.baseStore.Put(key, m)
+	return s.baseStore.PutContext(ctx, key, m)
 }
 func (s *hashStore) loadCheck() bool {
 	if !s.inTime {
@@ -1,16 +1,21 @@
 package crdtverse
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
 	query "github.com/ipfs/go-datastore/query"
 	pv "github.com/pilinsin/p2p-verse"
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
 )
 
 func TestKeyChange(t *testing.T) {
-	testKeyChange(t, pv.SampleHost)
+	n := p2pversetest.NewNetwork()
+	defer n.Close()
+	testKeyChange(t, n.HostGenerator())
 }
 
 func testKeyChange(t *testing.T, hGen pv.HostGenerator) {
@@ -26,24 +31,30 @@ func testKeyChange(t *testing.T, hGen pv.HostGenerator) {
 	db0 := tmp.(ISignatureStore)
 	t.Log("db0 generated")
 	checkError(t, db0.Put("aaa", []byte("meow meow ^.^")))
-	time.Sleep(time.Second * 10)
 
 	priv, pub, err := generateKeyPair()
 	checkError(t, err)
 	db0.ResetKeyPair(priv, pub)
 	checkError(t, db0.Put("aaa", []byte("meow meow 2 ^.^")))
-	time.Sleep(time.Second * 10)
 
 	db1 := newStore(t, hGen, "kc/kb", db0.Address(), "signature", baiStr)
 	t.Log("db1 generated")
 
-	rs, err := db1.Query(query.Query{
-		Filters: []query.Filter{KeyExistFilter{"aaa"}},
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = p2pversetest.WaitNoError(ctx, func() error {
+		kvs, err := p2pversetest.Snapshot(db1, query.Query{
+			Filters: []query.Filter{KeyExistFilter{"aaa"}},
+		})
+		if err != nil {
+			return err
+		}
+		if len(kvs) != 2 {
+			return fmt.Errorf("the number of records must be 2, but now is %d", len(kvs))
+		}
+		return nil
 	})
 	checkError(t, err)
-	ress, err := rs.Rest()
-	checkError(t, err)
-	assertError(t, len(ress) == 2, "the number of records must be 2, but now is", len(ress))
 
 	db0.Close()
 	db1.Close()
@@ -1,6 +1,7 @@
 package crdtverse
 
 import (
+	"context"
 	"time"
 )
 
@@ -16,8 +17,11 @@ type logStore struct {
 }
 
 func (cv *crdtVerse) NewLogStore(name string, opts ...*StoreOpts) (IStore, error) {
+	return cv.newLogStore(context.Background(), name, opts...)
+}
+func (cv *crdtVerse) newLogStore(ctx context.Context, name string, opts ...*StoreOpts) (IStore, error) {
 	st := &baseStore{}
-	if err := cv.initCRDT(name, newBaseValidator(st), st); err != nil {
+	if err := cv.initCRDT(ctx, name, "log", newBaseValidator(st), st, opts...); err != nil {
 		return nil, err
 	}
 
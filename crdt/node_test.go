@@ -0,0 +1,13 @@
+package crdtverse
+
+import (
+	"testing"
+
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
+)
+
+func TestNode(t *testing.T) {
+	n := p2pversetest.NewNetwork()
+	defer n.Close()
+	BaseTestNode(t, n.HostGenerator())
+}
@@ -0,0 +1,58 @@
+package crdtverse
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	pv "github.com/pilinsin/p2p-verse"
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
+)
+
+func BaseTestNode(t *testing.T, hGen pv.HostGenerator) {
+	bstrp, err := pv.NewBootstrap(hGen)
+	checkError(t, err)
+	defer bstrp.Close()
+	bAddrInfo := bstrp.AddrInfo()
+	t.Log("bootstrap AddrInfo: ", bAddrInfo)
+
+	node0, err := pv.NewNode(hGen, "nd/n0", false, bAddrInfo)
+	checkError(t, err)
+	node1, err := pv.NewNode(hGen, "nd/n1", false, bAddrInfo)
+	checkError(t, err)
+	cv0 := NewVerseFromNode(node0, "nd/na", false)
+	cv1 := NewVerseFromNode(node1, "nd/nb", false)
+
+	db0, err := cv0.NewStore("lg", "log")
+	checkError(t, err)
+	db0s, err := cv0.NewStore("sg", "signature")
+	checkError(t, err)
+	assertError(t, db0.AddrInfo().ID == db0s.AddrInfo().ID, "stores on the same node must share the host")
+	t.Log("db0 generated")
+
+	db1, err := cv1.NewStore(db0.Address(), "log")
+	checkError(t, err)
+	t.Log("db1 generated")
+
+	checkError(t, db0.Put("aaa", []byte("meow meow ^.^")))
+	t.Log("put done")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	v10, err := p2pversetest.WaitGet(ctx, db1, "aaa")
+	checkError(t, err)
+	t.Log(string(v10))
+
+	db0s.Close()
+	db0s, err = cv0.NewStore("sg", "signature")
+	checkError(t, err, "a closed store must be reopenable on the same node")
+
+	db0s.Close()
+	db0.Close()
+	db1.Close()
+	node0.Close()
+	node1.Close()
+	time.Sleep(time.Second)
+	os.RemoveAll("nd")
+	t.Log("finished")
+}
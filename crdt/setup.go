@@ -1,40 +1,38 @@
 package crdtverse
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"path/filepath"
+	"strings"
 	"time"
 
 	proto "google.golang.org/protobuf/proto"
 
-	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	p2ppubsub "github.com/libp2p/go-libp2p-pubsub"
 
-	ipfslt "github.com/hsanjuan/ipfs-lite"
 	cid "github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
 	badger "github.com/ipfs/go-ds-badger2"
 	crdt "github.com/ipfs/go-ds-crdt"
 	crdtpb "github.com/ipfs/go-ds-crdt/pb"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
 	dag "github.com/ipfs/go-merkledag"
 
 	pv "github.com/pilinsin/p2p-verse"
 )
 
 type storeParams struct {
-	dht    *pv.DiscoveryDHT
-	dStore ds.Datastore
-	dt     *crdt.Datastore
+	node    *pv.Node
+	ownNode bool
+	dStore  ds.Datastore
+	bc      *pubSubBroadcaster
+	dt      *crdt.Datastore
 }
 
-func (cv *crdtVerse) setupStore(ctx context.Context, h host.Host, name string, v iValidator) (*storeParams, error) {
-	dht, err := pv.NewDHT(h)
-	if err != nil {
-		return nil, err
-	}
-
+func (cv *crdtVerse) setupStore(ctx, stCtx context.Context, name string, v iValidator, logger pv.Logger) (*storeParams, error) {
 	dirAddr := filepath.Join(cv.dirPath, name)
 	stOpts := badger.DefaultOptions
 	stOpts.InMemory = false
@@ -43,99 +41,299 @@ func (cv *crdtVerse) setupStore(ctx context.Context, h host.Host, name string, v
 		return nil, err
 	}
 
-	ipfs, err := ipfslt.New(ctx, store, h, dht.DHT(), nil)
+	node, ownNode := cv.node, false
+	if node == nil {
+		node, err = pv.NewNodeWithDatastore(cv.hGenerator, store, cv.bootstraps...)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		if err := node.AddDiscoverers(cv.discs...); err != nil {
+			node.Close()
+			store.Close()
+			return nil, err
+		}
+		node.SetLogger(logger.With(pv.F("peer", node.Host().ID())))
+		ownNode = true
+	}
+	closeAll := func() {
+		if ownNode {
+			node.Close()
+		}
+		store.Close()
+	}
+
+	h := node.Host()
+	gossip := node.PubSub()
+	valid := validatorFunc(h.ID(), name, v, store, node.IPFS())
+	if err := gossip.RegisterTopicValidator(name, valid); err != nil {
+		closeAll()
+		return nil, err
+	}
+	psbc, err := newPubSubBroadcaster(stCtx, gossip, name)
 	if err != nil {
+		gossip.UnregisterTopicValidator(name)
+		closeAll()
 		return nil, err
 	}
 
-	gossip, err := p2ppubsub.NewGossipSub(ctx, h)
+	//the first value of a key is kept unless the values are deletable
+	var dtStore ds.Datastore = store
+	if !v.deletable() {
+		dtStore = newWriteOnceStore(store, name)
+	}
+	opts := crdt.DefaultOptions()
+	opts.RebroadcastInterval = 5 * time.Second
+	dt, err := crdt.New(dtStore, ds.NewKey(name), node.IPFS(), psbc, opts)
 	if err != nil {
+		psbc.close()
+		gossip.UnregisterTopicValidator(name)
+		closeAll()
 		return nil, err
 	}
-	valid := validatorFunc(h.ID(), v, store, ds.NewKey(name), ipfs)
-	if err := gossip.RegisterTopicValidator(name, valid); err != nil {
+
+	if err := node.DHT().BootstrapContext(ctx, storeKeyword(name), node.Bootstraps()); err != nil {
+		dt.Close()
+		psbc.close()
+		gossip.UnregisterTopicValidator(name)
+		closeAll()
 		return nil, err
 	}
-	psbc, err := crdt.NewPubSubBroadcaster(ctx, gossip, name)
+	return &storeParams{node, ownNode, store, psbc, dt}, nil
+}
+
+//the rendezvous of the replicas of a store
+func storeKeyword(name string) string {
+	return "crdt-keyword:" + name
+}
+
+//pubSubBroadcaster is crdt.PubSubBroadcaster which also leaves the topic when closed,
+//so that the same store can be reopened on a shared pv.Node.
+type pubSubBroadcaster struct {
+	ctx   context.Context
+	topic *p2ppubsub.Topic
+	subs  *p2ppubsub.Subscription
+}
+
+func newPubSubBroadcaster(ctx context.Context, psub *p2ppubsub.PubSub, topic string) (*pubSubBroadcaster, error) {
+	psubTopic, err := psub.Join(topic)
 	if err != nil {
 		return nil, err
 	}
-
-	opts := crdt.DefaultOptions()
-	opts.RebroadcastInterval = 5 * time.Second
-	dt, err := crdt.New(store, ds.NewKey(name), ipfs, psbc, opts)
+	subs, err := psubTopic.Subscribe()
 	if err != nil {
+		psubTopic.Close()
 		return nil, err
 	}
+	return &pubSubBroadcaster{ctx, psubTopic, subs}, nil
+}
+func (bc *pubSubBroadcaster) Broadcast(data []byte) error {
+	return bc.topic.Publish(bc.ctx, data)
+}
+func (bc *pubSubBroadcaster) Next() ([]byte, error) {
+	select {
+	case <-bc.ctx.Done():
+		return nil, crdt.ErrNoMoreBroadcast
+	default:
+	}
 
-	if err := dht.Bootstrap("crdt-keyword", cv.bootstraps); err != nil {
+	msg, err := bc.subs.Next(bc.ctx)
+	if err != nil {
+		if strings.Contains(err.Error(), "subscription cancelled") ||
+			strings.Contains(err.Error(), "context") {
+			return nil, crdt.ErrNoMoreBroadcast
+		}
 		return nil, err
 	}
-	return &storeParams{dht, store, dt}, nil
+	return msg.GetData(), nil
+}
+func (bc *pubSubBroadcaster) close() error {
+	bc.subs.Cancel()
+	//the subscription is removed asynchronously
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = bc.topic.Close(); err == nil {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return err
 }
 
-func validatorFunc(hid peer.ID, v iValidator, dstore ds.Datastore, ns ds.Key, dg crdt.SessionDAGService) p2ppubsub.Validator {
-	return func(ctx context.Context, pid peer.ID, msg *p2ppubsub.Message) bool {
+//invalid deltas and tombstones are rejected with a pv.MessageOffense, so that the author is reported to the pv.Gater of the host.
+//a tombstone is valid only with a new deletion record of its key in the same delta,
+//which is signed by the owner of the key and has the id of the tombstone, i.e. a store of signatures is not append-only.
+//a replay of an existing record is rejected without an offense, since it depends on the local state.
+//not only the heads but all the deltas which are not processed yet are validated, since go-ds-crdt merges all of them.
+//a message is ignored if it has a delta which is not available, a value after the time limit, or a time ahead of the local clock.
+//the validation does not depend on the values of the existing keys, so that all the replicas merge the same deltas,
+//and a concurrent write of an existing key of a store which is not deletable is resolved by writeOnceStore.
+//a message of the existing values only is also ignored, since honest peers rebroadcast them.
+func validatorFunc(hid peer.ID, name string, v iValidator, dstore ds.Datastore, dg crdt.SessionDAGService) p2ppubsub.ValidatorEx {
+	reject := func(msg *p2ppubsub.Message, reason string, offense bool) p2ppubsub.ValidationResult {
+		pv.DefaultMetrics().Inc("p2pverse_store_validator_rejections_total", "store", name, "reason", reason)
+		if offense {
+			msg.ValidatorData = pv.MessageOffense{Reason: reason}
+		}
+		return p2ppubsub.ValidationReject
+	}
+	return func(ctx context.Context, pid peer.ID, msg *p2ppubsub.Message) p2ppubsub.ValidationResult {
 		if hid.String() == pid.String() {
-			return true
+			return p2ppubsub.ValidationAccept
 		}
 
-		deltas, err := msgToDeltas(ctx, msg, dg)
+		deltas, err := unprocessedDeltas(ctx, name, msg, dstore, dg)
 		if err != nil {
-			return false
+			return reject(msg, "malformed", true)
 		}
 
+		res := p2ppubsub.ValidationIgnore
 		for _, delta := range deltas {
+			if delta == nil {
+				return p2ppubsub.ValidationIgnore
+			}
+			records := make(map[string][]string)
 			for _, elem := range delta.Elements {
-				ok := validate(elem.Key, elem.Value, v, dstore, ns)
-				if !ok {
-					return false
+				//an existing value is not validated again,
+				//so that the rebroadcasts of the values in a legacy format are not rejected.
+				if _, same := existing(name, elem.Key, elem.Value, dstore); same {
+					continue
 				}
+
+				switch validate(name, elem.Key, elem.Value, v) {
+				case p2ppubsub.ValidationReject:
+					return reject(msg, "invalid", true)
+				case p2ppubsub.ValidationIgnore:
+					return p2ppubsub.ValidationIgnore
+				}
+				if isTombstoneKey(elem.Key) {
+					records[ds.NewKey(elem.Key).String()] = tombstoneIDs(elem.Value)
+				}
+				res = p2ppubsub.ValidationAccept
 			}
-			//append-only
-			if len(delta.Tombstones) > 0 {
-				return false
+			for _, tomb := range delta.Tombstones {
+				//a rebroadcast of an applied tombstone
+				if tombed(name, tomb.Key, tomb.Id, dstore) {
+					continue
+				}
+				ids, ok := records[tombstoneKey(tomb.Key)]
+				if !ok {
+					if exist, _ := existing(name, tombstoneKey(tomb.Key), nil, dstore); exist {
+						return reject(msg, "replay", false)
+					}
+					return reject(msg, "tombstone", true)
+				}
+				if !hasID(ids, tomb.Id) {
+					return reject(msg, "tombstone", true)
+				}
 			}
 		}
-		return true
+		return res
 	}
 }
 
-func validate(key string, val []byte, v iValidator, d ds.Datastore, ns ds.Key) bool {
-	if ok := v.Validate(key, val); !ok {
-		return false
+//existing reports whether key has a value in the store and whether the value equals val.
+func existing(name, key string, val []byte, d ds.Datastore) (bool, bool) {
+	vkey := ds.NewKey(name).ChildString("s").ChildString("k").ChildString(key).ChildString("v")
+	cur, err := d.Get(context.Background(), vkey)
+	if err != nil {
+		return false, false
+	}
+	return true, bytes.Equal(cur, val)
+}
+
+//tombed reports whether the element id of key is already deleted in the store.
+func tombed(name, key, id string, d ds.Datastore) bool {
+	ok, err := d.Has(context.Background(), tombsPrefix(name, key).ChildString(id))
+	return err == nil && ok
+}
+func hasID(ids []string, id string) bool {
+	id = ds.NewKey(id).String()
+	for _, i := range ids {
+		if ds.NewKey(i).String() == id {
+			return true
+		}
 	}
+	return false
+}
 
-	vkey := ns.ChildString("s").ChildString("k").ChildString(key).ChildString("v")
-	exist, err := d.Has(context.Background(), vkey)
-	return !exist || err != nil
+func validate(name, key string, val []byte, v iValidator) p2ppubsub.ValidationResult {
+	if !v.isInTime() {
+		return p2ppubsub.ValidationIgnore
+	}
+	if isTombstoneKey(key) {
+		if !v.deletable() {
+			return p2ppubsub.ValidationReject
+		}
+		return validateTombstone(name, key, val)
+	} else if v.ahead(key) {
+		return p2ppubsub.ValidationIgnore
+	} else if ok := v.Validate(key, val); !ok {
+		if v.deletable() && isLegacySignature(key, val) {
+			return p2ppubsub.ValidationIgnore
+		}
+		return p2ppubsub.ValidationReject
+	}
+	return p2ppubsub.ValidationAccept
 }
 
-func msgToDeltas(ctx context.Context, msg *p2ppubsub.Message, dg crdt.SessionDAGService) ([]*crdtpb.Delta, error) {
+//unprocessedDeltas returns the deltas of the heads of msg and their ancestors which are not processed yet,
+//i.e. all the deltas which go-ds-crdt merges when it receives msg.
+//the walk stops at a block which is not available and its delta is nil.
+func unprocessedDeltas(ctx context.Context, name string, msg *p2ppubsub.Message, dstore ds.Datastore, dg crdt.SessionDAGService) ([]*crdtpb.Delta, error) {
 	heads, err := msgToCRDTHeads(msg)
 	if err != nil {
 		return nil, err
 	}
 
 	ng := dg.Session(ctx)
-	deltas := make([]*crdtpb.Delta, 0, len(heads))
-	for _, c := range heads {
+	getNode := func(c cid.Cid) (*dag.ProtoNode, *crdtpb.Delta) {
 		nd, err := ng.Get(ctx, c)
 		if err != nil {
-			continue
+			return nil, nil
 		}
 		prnd, ok := nd.(*dag.ProtoNode)
 		if !ok {
-			continue
+			return nil, nil
 		}
 		d := &crdtpb.Delta{}
 		if err := proto.Unmarshal(prnd.Data(), d); err != nil {
+			return nil, nil
+		}
+		return prnd, d
+	}
+
+	deltas := make([]*crdtpb.Delta, 0, len(heads))
+	visited := make(map[string]struct{})
+	for len(heads) > 0 {
+		c := heads[0]
+		heads = heads[1:]
+		if _, ok := visited[c.KeyString()]; ok {
 			continue
 		}
+		visited[c.KeyString()] = struct{}{}
+		if processed(name, c, dstore) {
+			continue
+		}
+
+		nd, d := getNode(c)
 		deltas = append(deltas, d)
+		if d == nil {
+			return deltas, nil
+		}
+		for _, l := range nd.Links() {
+			heads = append(heads, l.Cid)
+		}
 	}
 	return deltas, nil
 }
+
+//processed reports whether the block c is already merged by go-ds-crdt, which marks it at /<name>/b/<multihash>.
+func processed(name string, c cid.Cid, d ds.Datastore) bool {
+	key := ds.NewKey(name).ChildString("b").ChildString(dshelp.MultihashToDsKey(c.Hash()).String())
+	ok, err := d.Has(context.Background(), key)
+	return err == nil && ok
+}
 func msgToCRDTHeads(msg *p2ppubsub.Message) ([]cid.Cid, error) {
 	bcastData := crdtpb.CRDTBroadcast{}
 	if err := proto.Unmarshal(msg.GetData(), &bcastData); err != nil {
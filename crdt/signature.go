@@ -1,10 +1,12 @@
 package crdtverse
 
 import (
+	"context"
 	"errors"
 	"strings"
 	"time"
 
+	ds "github.com/ipfs/go-datastore"
 	query "github.com/ipfs/go-datastore/query"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	pb "github.com/pilinsin/p2p-verse/crdt/pb"
@@ -32,10 +34,12 @@ func StrToPubKey(s string) (IPubKey, error) {
 
 type signatureValidator struct {
 	iValidator
+	legacy bool
 }
 
-func newSignatureValidator(s IStore) iValidator {
-	return &signatureValidator{newBaseValidator(s)}
+//the values of legacySignatureVersion are valid if legacy.
+func newSignatureValidator(s IStore, legacy bool) iValidator {
+	return &signatureValidator{newBaseValidator(s), legacy}
 }
 func (v *signatureValidator) Validate(key string, val []byte) bool {
 	if ok := v.iValidator.Validate(key, val); !ok {
@@ -52,10 +56,127 @@ func (v *signatureValidator) Validate(key string, val []byte) bool {
 	if err := proto.Unmarshal(val, sd); err != nil {
 		return false
 	}
+	if v.legacy && sd.GetVersion() == legacySignatureVersion {
+		ok, err := vk.Verify(sd.GetValue(), sd.GetSign())
+		return err == nil && ok
+	}
+	return verifySignatureData(vk, v.storeAddress(), key, sd)
+}
+func (v *signatureValidator) deletable() bool { return true }
+
+//isLegacySignature reports whether val is a value of legacySignatureVersion signed by the pid of key.
+//such a value is ignored instead of rejected after the transition, since the honest peers rebroadcast it until MigrateSignatures.
+func isLegacySignature(key string, val []byte) bool {
+	keys := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	vk, err := StrToPubKey(keys[0])
+	if err != nil {
+		return false
+	}
+	sd := &pb.SignatureData{}
+	if err := proto.Unmarshal(val, sd); err != nil {
+		return false
+	}
+	if sd.GetVersion() != legacySignatureVersion {
+		return false
+	}
 	ok, err := vk.Verify(sd.GetValue(), sd.GetSign())
 	return err == nil && ok
 }
 
+//the versions of pb.SignatureData.
+//the signature of legacySignatureVersion covers only the value,
+//so that it can be copied to another key or store of the same pid.
+//the signature of signatureVersion covers pb.SignedValue, i.e. also the store address and the full key.
+//the store address includes the salt and the time limit, and the full key of an updatable store includes its tKey.
+const (
+	legacySignatureVersion = 0
+	signatureVersion       = 1
+)
+
+func signedValue(addr, key string, val []byte) ([]byte, error) {
+	sv := &pb.SignedValue{
+		Store: addr,
+		Key:   ds.NewKey(key).String(),
+		Value: val,
+	}
+	return proto.Marshal(sv)
+}
+
+//signValue returns the marshaled pb.SignatureData of val put at key of the store addr.
+func signValue(priv IPrivKey, addr, key string, val []byte) ([]byte, error) {
+	if priv == nil {
+		return nil, errors.New("no valid privKey")
+	}
+
+	msv, err := signedValue(addr, key, val)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := priv.Sign(msv)
+	if err != nil {
+		return nil, err
+	}
+	sd := &pb.SignatureData{
+		Value:   val,
+		Sign:    sign,
+		Version: signatureVersion,
+	}
+	return proto.Marshal(sd)
+}
+
+//the signatures of legacySignatureVersion are accepted from the other peers only during the transition (see StoreOpts).
+//the existing values of them are still readable and can be re-signed by MigrateSignatures.
+func verifySignatureData(vk IPubKey, addr, key string, sd *pb.SignatureData) bool {
+	if sd.GetVersion() != signatureVersion {
+		return false
+	}
+	msv, err := signedValue(addr, key, sd.GetValue())
+	if err != nil {
+		return false
+	}
+	ok, err := vk.Verify(msv, sd.GetSign())
+	return err == nil && ok
+}
+
+//migrateSignatures re-signs the values of legacySignatureVersion under the pid of priv in place.
+func (s *baseStore) migrateSignatures(ctx context.Context, priv IPrivKey, pub IPubKey) error {
+	sKey := PubKeyToStr(pub)
+	if sKey == "" {
+		return errors.New("invalid pubKey")
+	}
+
+	rs, err := s.QueryContext(ctx, query.Query{Prefix: "/" + sKey})
+	if err != nil {
+		return err
+	}
+	resList, err := rs.Rest()
+	if err != nil {
+		return err
+	}
+	for _, res := range resList {
+		sd := &pb.SignatureData{}
+		if err := proto.Unmarshal(res.Value, sd); err != nil {
+			continue
+		}
+		if sd.GetVersion() != legacySignatureVersion {
+			continue
+		}
+		if ok, err := pub.Verify(sd.GetValue(), sd.GetSign()); err != nil || !ok {
+			continue
+		}
+
+		msd, err := signValue(priv, s.Address(), res.Key, sd.GetValue())
+		if err != nil {
+			return err
+		}
+		//the re-signed value replaces the legacy one as a newer write of the same key
+		if err := s.dt.Put(ctx, ds.NewKey(res.Key), msd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func getSignatureOpts(opts ...*StoreOpts) (IPrivKey, IPubKey, time.Time) {
 	if len(opts) == 0 {
 		priv, pub, _ := generateKeyPair()
@@ -66,10 +187,21 @@ func getSignatureOpts(opts ...*StoreOpts) (IPrivKey, IPubKey, time.Time) {
 	}
 	return opts[0].Priv, opts[0].Pub, opts[0].TimeLimit
 }
+func acceptsLegacySignatures(opts ...*StoreOpts) bool {
+	return len(opts) == 0 || !opts[0].RejectLegacySignatures
+}
 
 type ISignatureStore interface {
 	IStore
 	ResetKeyPair(IPrivKey, IPubKey)
+	//Delete removes the value put with the key pair of the store,
+	//i.e. the key is given without the pid prefix as in Put.
+	Delete(string) error
+	DeleteContext(context.Context, string) error
+	//MigrateSignatures re-signs the values put with the key pair of the store
+	//in the legacy format, whose signatures do not cover the key and the store.
+	MigrateSignatures() error
+	MigrateSignaturesContext(context.Context) error
 }
 
 type signatureStore struct {
@@ -79,12 +211,18 @@ type signatureStore struct {
 }
 
 func (cv *crdtVerse) NewSignatureStore(name string, opts ...*StoreOpts) (ISignatureStore, error) {
+	return cv.newSignatureStore(context.Background(), name, opts...)
+}
+func (cv *crdtVerse) newSignatureStore(ctx context.Context, name string, opts ...*StoreOpts) (ISignatureStore, error) {
 	st := &baseStore{}
-	if err := cv.initCRDT(name, newSignatureValidator(st), st); err != nil {
+	if err := cv.initCRDT(ctx, name, "signature", newSignatureValidator(st, acceptsLegacySignatures(opts...)), st, opts...); err != nil {
 		return nil, err
 	}
 
 	priv, pub, tl := getSignatureOpts(opts...)
+	if len(opts) > 0 {
+		st.salt = opts[0].Salt
+	}
 	st.timeLimit = tl
 	st.setTimeLimit()
 	return &signatureStore{st, priv, pub}, nil
@@ -99,32 +237,51 @@ func (s *signatureStore) ResetKeyPair(priv IPrivKey, pub IPubKey) {
 }
 
 func (s *signatureStore) Put(key string, val []byte) error {
-	if s.priv == nil {
-		return errors.New("no valid privKey")
+	return s.PutContext(s.ctx, key, val)
+}
+func (s *signatureStore) PutContext(ctx context.Context, key string, val []byte) error {
+	sKey := PubKeyToStr(s.pub)
+	if sKey == "" {
+		return errors.New("invalid pubKey")
 	}
+	key = sKey + "/" + key
 
-	sign, err := s.priv.Sign(val)
-	if err != nil {
-		return err
-	}
-	sd := &pb.SignatureData{
-		Value: val,
-		Sign:  sign,
-	}
-	msd, err := proto.Marshal(sd)
+	msd, err := signValue(s.priv, s.Address(), key, val)
 	if err != nil {
 		return err
 	}
-
+	return s.baseStore.PutContext(ctx, key, msd)
+}
+func (s *signatureStore) Delete(key string) error {
+	return s.DeleteContext(s.ctx, key)
+}
+func (s *signatureStore) DeleteContext(ctx context.Context, key string) error {
 	sKey := PubKeyToStr(s.pub)
 	if sKey == "" {
 		return errors.New("invalid pubKey")
 	}
 	key = sKey + "/" + key
-	return s.baseStore.Put(key, msd)
+
+	exist, err := s.baseStore.HasContext(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return ds.ErrNotFound
+	}
+	return s.deleteKeys(ctx, s.priv, key)
+}
+func (s *signatureStore) MigrateSignatures() error {
+	return s.MigrateSignaturesContext(s.ctx)
+}
+func (s *signatureStore) MigrateSignaturesContext(ctx context.Context) error {
+	return s.migrateSignatures(ctx, s.priv, s.pub)
 }
 func (s *signatureStore) Get(key string) ([]byte, error) {
-	msd, err := s.baseStore.Get(key)
+	return s.GetContext(s.ctx, key)
+}
+func (s *signatureStore) GetContext(ctx context.Context, key string) ([]byte, error) {
+	msd, err := s.baseStore.GetContext(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -143,6 +300,9 @@ func (s *signatureStore) GetSize(key string) (int, error) {
 }
 
 func (s *signatureStore) Query(qs ...query.Query) (query.Results, error) {
+	return s.QueryContext(s.ctx, qs...)
+}
+func (s *signatureStore) QueryContext(ctx context.Context, qs ...query.Query) (query.Results, error) {
 	var q query.Query
 	if len(qs) == 0 {
 		q = query.Query{}
@@ -150,7 +310,7 @@ func (s *signatureStore) Query(qs ...query.Query) (query.Results, error) {
 		q = qs[0]
 	}
 
-	rs, err := s.baseStore.Query(q)
+	rs, err := s.baseStore.QueryContext(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -158,20 +318,15 @@ func (s *signatureStore) Query(qs ...query.Query) (query.Results, error) {
 		return rs, nil
 	}
 
-	ch := make(chan query.Result)
-	go func() {
-		defer close(ch)
-		for r := range rs.Next() {
-			sd := &pb.SignatureData{}
-			if err := proto.Unmarshal(r.Value, sd); err != nil {
-				continue
-			}
-
-			r.Value = sd.GetValue()
-			ch <- r
+	return s.forward(ctx, rs, func(r query.Result) (query.Result, bool) {
+		sd := &pb.SignatureData{}
+		if err := proto.Unmarshal(r.Value, sd); err != nil {
+			return r, false
 		}
-	}()
-	return query.ResultsWithChan(query.Query{}, ch), nil
+
+		r.Value = sd.GetValue()
+		return r, true
+	}), nil
 }
 
 func (s *signatureStore) accessFromKey(key string) string {
@@ -188,39 +343,24 @@ func (s *signatureStore) putKey(key string) string {
 	}
 	return sKey + "/" + key
 }
-func (s *signatureStore) acQuery(acKey string) (query.Results, error) {
-	return s.Query(query.Query{
+func (s *signatureStore) acQuery(ctx context.Context, acKey string) (query.Results, error) {
+	return s.QueryContext(ctx, query.Query{
 		Filters: []query.Filter{KeyExistFilter{Key: acKey}},
 	})
 }
 
-func (s *signatureStore) initPut() error {
-	if s.priv == nil {
-		return errors.New("no valid privKey")
-	}
-
-	val := []byte(s.name)
-
-	sign, err := s.priv.Sign(val)
-	if err != nil {
-		return err
-	}
-	sd := &pb.SignatureData{
-		Value: val,
-		Sign:  sign,
-	}
-	msd, err := proto.Marshal(sd)
-	if err != nil {
-		return err
-	}
-
+func (s *signatureStore) initPut(ctx context.Context) error {
 	sKey := PubKeyToStr(s.pub)
 	if sKey == "" {
 		return errors.New("invalid pubKey")
 	}
-
 	key := sKey + "/" + s.name
-	return s.baseStore.Put(key, msd)
+
+	msd, err := signValue(s.priv, s.Address(), key, []byte(s.name))
+	if err != nil {
+		return err
+	}
+	return s.baseStore.PutContext(ctx, key, msd)
 }
 func (s *signatureStore) loadCheck() bool {
 	if !s.inTime {
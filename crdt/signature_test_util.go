@@ -5,8 +5,14 @@ import (
 	"testing"
 	"time"
 
+	ds "github.com/ipfs/go-datastore"
 	query "github.com/ipfs/go-datastore/query"
+	crdtpb "github.com/ipfs/go-ds-crdt/pb"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
 	pv "github.com/pilinsin/p2p-verse"
+	pb "github.com/pilinsin/p2p-verse/crdt/pb"
+	proto "google.golang.org/protobuf/proto"
 )
 
 func BaseTestSignatureStore(t *testing.T, hGen pv.HostGenerator) {
@@ -58,9 +64,129 @@ func BaseTestSignatureStore(t *testing.T, hGen pv.HostGenerator) {
 		t.Log(string(res.Value))
 	}
 
+	checkError(t, db0.(ISignatureStore).Delete("aaa"))
+	assertError(t, db1.(ISignatureStore).Delete("aaa") != nil, "Delete of others' key must be fail")
+	t.Log("delete done")
+	time.Sleep(time.Second * 10)
+
+	ok, err = db1.Has(PubKeyToStr(opts0.Pub) + "/aaa")
+	checkError(t, err)
+	assertError(t, !ok, "the deleted key must not exist")
+	rs13, err := db1.Query()
+	checkError(t, err)
+	for res := range rs13.Next() {
+		assertError(t, !isTombstoneKey(res.Key), "deletion records must not be queried")
+	}
+
+	//a value in the legacy format of another writer is replicated during the transition
+	pid0 := PubKeyToStr(opts0.Pub)
+	st0 := db0.(*signatureStore)
+	sign, err := opts0.Priv.Sign([]byte("legacy"))
+	checkError(t, err)
+	msd, err := proto.Marshal(&pb.SignatureData{Value: []byte("legacy"), Sign: sign})
+	checkError(t, err)
+	checkError(t, st0.dt.Put(st0.ctx, ds.NewKey(pid0+"/ccc"), msd))
+	t.Log("legacy put done")
+	time.Sleep(time.Second * 10)
+
+	v15, err := db1.Get(pid0 + "/ccc")
+	checkError(t, err)
+	assertError(t, string(v15) == "legacy", "the legacy value must be replicated")
+
+	//a value in the legacy format is readable after MigrateSignatures
+	checkError(t, st0.MigrateSignatures())
+	t.Log("migrate done")
+	time.Sleep(time.Second * 10)
+
+	v13, err := db1.Get(pid0 + "/ccc")
+	checkError(t, err)
+	assertError(t, string(v13) == "legacy", "the migrated value must be got")
+
+	//a replayed deletion record does not delete a value put again.
+	//the rejected writes are the last of db0, since the later deltas of db0 are rejected with them.
+	checkError(t, db0.Put("aaa", []byte("meow meow 3 ^.^")))
+	time.Sleep(time.Second * 10)
+	record, err := st0.dt.Get(st0.ctx, ds.NewKey(tombstoneKey(pid0+"/aaa")))
+	checkError(t, err)
+	b, err := st0.dt.Batch(st0.ctx)
+	checkError(t, err)
+	checkError(t, b.Put(st0.ctx, ds.NewKey(tombstoneKey(pid0+"/aaa")), record))
+	checkError(t, b.Delete(st0.ctx, ds.NewKey(pid0+"/aaa")))
+	checkError(t, b.Commit(st0.ctx))
+	t.Log("replay done")
+	time.Sleep(time.Second * 10)
+
+	v14, err := db1.Get(pid0 + "/aaa")
+	checkError(t, err)
+	assertError(t, string(v14) == "meow meow 3 ^.^", "the value must not be deleted by a replayed record")
+
+	//a signature copied to another key is rejected
+	msd, err = st0.baseStore.Get(pid0 + "/ccc")
+	checkError(t, err)
+	checkError(t, st0.dt.Put(st0.ctx, ds.NewKey(pid0+"/ddd"), msd))
+	//a signature for another store of the same name is rejected
+	other := MakeAddress(st0.name, "", []byte("other salt"))
+	msd, err = signValue(opts0.Priv, other, pid0+"/eee", []byte("other store"))
+	checkError(t, err)
+	checkError(t, st0.dt.Put(st0.ctx, ds.NewKey(pid0+"/eee"), msd))
+	t.Log("replay done")
+	time.Sleep(time.Second * 10)
+
+	ok, err = db1.Has(pid0 + "/ddd")
+	checkError(t, err)
+	assertError(t, !ok, "the replayed value must not exist")
+	ok, err = db1.Has(pid0 + "/eee")
+	checkError(t, err)
+	assertError(t, !ok, "the value of another store must not exist")
+
+	//an invalid delta under a valid head is rejected
+	msd, err = st0.baseStore.Get(pid0 + "/ccc")
+	checkError(t, err)
+	parent, err := deltaNode(&crdtpb.Delta{
+		Elements: []*crdtpb.Element{{Key: pid0 + "/fff", Value: msd}},
+		Priority: 1,
+	})
+	checkError(t, err)
+	msd, err = signValue(opts0.Priv, st0.Address(), pid0+"/ggg", []byte("valid head"))
+	checkError(t, err)
+	head, err := deltaNode(&crdtpb.Delta{
+		Elements: []*crdtpb.Element{{Key: pid0 + "/ggg", Value: msd}},
+		Priority: 2,
+	}, parent)
+	checkError(t, err)
+	checkError(t, st0.node.IPFS().AddMany(st0.ctx, []ipld.Node{parent, head}))
+	bcast, err := proto.Marshal(&crdtpb.CRDTBroadcast{Heads: []*crdtpb.Head{{Cid: head.Cid().Bytes()}}})
+	checkError(t, err)
+	checkError(t, st0.bc.Broadcast(bcast))
+	t.Log("broadcast done")
+	time.Sleep(time.Second * 10)
+
+	ok, err = db1.Has(pid0 + "/fff")
+	checkError(t, err)
+	assertError(t, !ok, "the value of an invalid delta must not exist")
+	ok, err = db1.Has(pid0 + "/ggg")
+	checkError(t, err)
+	assertError(t, !ok, "the value of a head over an invalid delta must not exist")
+
 	db0.Close()
 	db1.Close()
 	time.Sleep(time.Second)
 	os.RemoveAll("ss")
 	t.Log("finished")
 }
+
+//deltaNode makes a block of go-ds-crdt with delta and the parents.
+func deltaNode(delta *crdtpb.Delta, parents ...ipld.Node) (ipld.Node, error) {
+	data, err := proto.Marshal(delta)
+	if err != nil {
+		return nil, err
+	}
+	nd := dag.NodeWithData(data)
+	for _, p := range parents {
+		if err := nd.AddRawLink("", &ipld.Link{Cid: p.Cid()}); err != nil {
+			return nil, err
+		}
+	}
+	nd.SetCidBuilder(dag.V1CidPrefix())
+	return nd, nil
+}
@@ -3,9 +3,11 @@ package crdtverse
 import (
 	"testing"
 
-	pv "github.com/pilinsin/p2p-verse"
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
 )
 
 func TestTimeLimit(t *testing.T) {
-	BaseTestTimeLimit(t, pv.SampleHost)
+	n := p2pversetest.NewNetwork()
+	defer n.Close()
+	BaseTestTimeLimit(t, n.HostGenerator())
 }
@@ -1,12 +1,14 @@
 package crdtverse
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
 
 	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
 	pv "github.com/pilinsin/p2p-verse"
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
 )
 
 func BaseTestTimeLimit(t *testing.T, hGen pv.HostGenerator) {
@@ -28,7 +30,9 @@ func BaseTestTimeLimit(t *testing.T, hGen pv.HostGenerator) {
 
 	checkError(t, db0.Put("aaa", []byte("meow meow ^.^")))
 	t.Log("put done")
-	time.Sleep(time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	checkError(t, p2pversetest.WaitFor(ctx, func() bool { return !db0.isInTime() }), "db0 must be timeout")
 
 	db1 := newStore(t, hGen, "tc/tb", db0.Address(), "updatableSignature", baiStr)
 	t.Log("db1 generated")
@@ -0,0 +1,187 @@
+package crdtverse
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	p2ppubsub "github.com/libp2p/go-libp2p-pubsub"
+	pv "github.com/pilinsin/p2p-verse"
+	pb "github.com/pilinsin/p2p-verse/crdt/pb"
+	proto "google.golang.org/protobuf/proto"
+)
+
+//a deletion of <key> is recorded at <tombstoneNs>/<key> with the tombstone signed by the owner of <key>,
+//so that the other peers can verify the tombstones of the crdt.
+const tombstoneNs = "/.tombstone"
+
+func tombstoneKey(key string) string {
+	return tombstoneNs + ds.NewKey(key).String()
+}
+func isTombstoneKey(key string) bool {
+	return strings.HasPrefix(ds.NewKey(key).String(), tombstoneNs+"/")
+}
+
+//the elements and the tombstones of <key> are kept under /<name>/s/s/<key> and /<name>/s/t/<key> by go-ds-crdt,
+//and both are identified by /<block id>.
+func elemsPrefix(name, key string) ds.Key {
+	return ds.NewKey(name).ChildString("s").ChildString("s").ChildString(key)
+}
+func tombsPrefix(name, key string) ds.Key {
+	return ds.NewKey(name).ChildString("s").ChildString("t").ChildString(key)
+}
+
+//elementIDs returns the ids of the elements of key which are not deleted yet,
+//i.e. the ids which go-ds-crdt puts in the tombstones of a deletion of key.
+func elementIDs(ctx context.Context, d ds.Datastore, name, key string) ([]string, error) {
+	prefix := elemsPrefix(name, key).String()
+	rs, err := d.Query(ctx, query.Query{Prefix: prefix, KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := rs.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		id := strings.TrimPrefix(e.Key, prefix)
+		//the elements of the other keys under key
+		if !ds.RawKey(id).IsTopLevel() {
+			continue
+		}
+		tombed, err := d.Has(ctx, tombsPrefix(name, key).ChildString(id))
+		if err != nil {
+			return nil, err
+		}
+		if !tombed {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+//tombstoneFilter hides the deletion records from the queries.
+type tombstoneFilter struct{}
+
+func (f tombstoneFilter) Filter(e query.Entry) bool {
+	return !isTombstoneKey(e.Key)
+}
+
+//validateTombstone verifies a deletion record of the store name.
+//key is the record key and the owner of the deleted key is the pid of its first element.
+//a record whose time is ahead of the local clock by more than maxClockSkew is ignored, since it may be valid later.
+func validateTombstone(name, key string, val []byte) p2ppubsub.ValidationResult {
+	dKey := strings.TrimPrefix(ds.NewKey(key).String(), tombstoneNs)
+	keys := strings.Split(strings.TrimPrefix(dKey, "/"), "/")
+	vk, err := StrToPubKey(keys[0])
+	if err != nil {
+		return p2ppubsub.ValidationReject
+	}
+
+	sd := &pb.SignatureData{}
+	if err := proto.Unmarshal(val, sd); err != nil {
+		return p2ppubsub.ValidationReject
+	}
+	ts := &pb.Tombstone{}
+	if err := proto.Unmarshal(sd.GetValue(), ts); err != nil {
+		return p2ppubsub.ValidationReject
+	}
+	if ts.GetStore() != name || ts.GetKey() != dKey {
+		return p2ppubsub.ValidationReject
+	}
+
+	t := time.Time{}
+	if err := t.UnmarshalBinary(ts.GetTime()); err != nil {
+		return p2ppubsub.ValidationReject
+	}
+	isUTC := t.Location().String() == time.UTC.String()
+	if !isUTC {
+		return p2ppubsub.ValidationReject
+	}
+	if ok, err := vk.Verify(sd.GetValue(), sd.GetSign()); err != nil || !ok {
+		return p2ppubsub.ValidationReject
+	}
+	if t.After(time.Now().UTC().Add(maxClockSkew)) {
+		return p2ppubsub.ValidationIgnore
+	}
+	return p2ppubsub.ValidationAccept
+}
+
+//tombstoneIDs returns the ids of the elements deleted with a deletion record.
+func tombstoneIDs(val []byte) []string {
+	sd := &pb.SignatureData{}
+	if err := proto.Unmarshal(val, sd); err != nil {
+		return nil
+	}
+	ts := &pb.Tombstone{}
+	if err := proto.Unmarshal(sd.GetValue(), ts); err != nil {
+		return nil
+	}
+	return ts.GetIds()
+}
+
+//deleteKeys removes keys and puts their deletion records signed by priv in a delta.
+//a record has the ids of the deleted elements, so that it cannot be a proof of the other deletions of the key.
+func (s *baseStore) deleteKeys(ctx context.Context, priv IPrivKey, keys ...string) error {
+	if priv == nil {
+		return errors.New("no valid privKey")
+	}
+	if len(keys) == 0 {
+		return ds.ErrNotFound
+	}
+
+	tb, err := time.Now().UTC().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	b, err := s.dt.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		key = ds.NewKey(key).String()
+		ids, err := elementIDs(ctx, s.dStore, s.name, key)
+		if err != nil {
+			return err
+		}
+		ts := &pb.Tombstone{
+			Store: s.name,
+			Key:   key,
+			Time:  tb,
+			Ids:   ids,
+		}
+		mts, err := proto.Marshal(ts)
+		if err != nil {
+			return err
+		}
+		sign, err := priv.Sign(mts)
+		if err != nil {
+			return err
+		}
+		sd := &pb.SignatureData{
+			Value: mts,
+			Sign:  sign,
+		}
+		msd, err := proto.Marshal(sd)
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(ctx, ds.NewKey(tombstoneKey(key)), msd); err != nil {
+			return err
+		}
+		if err := b.Delete(ctx, ds.NewKey(key)); err != nil {
+			return err
+		}
+	}
+	if err := b.Commit(ctx); err != nil {
+		return err
+	}
+	pv.DefaultMetrics().Add("p2pverse_store_deletes_total", float64(len(keys)), "store", s.name, "mode", s.mode)
+	return nil
+}
@@ -1,6 +1,7 @@
 package crdtverse
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"strings"
@@ -77,25 +78,34 @@ func (v *updatableValidator) Validate(key string, val []byte) bool {
 		return false
 	}
 
+	t, ok := keyTime(key)
+	return ok && t.Location().String() == time.UTC.String()
+}
+func (v *updatableValidator) ahead(key string) bool {
+	t, ok := keyTime(key)
+	return ok && !t.Before(time.Now().UTC())
+}
+
+//keyTime returns the time of the last element of key.
+func keyTime(key string) (time.Time, bool) {
 	keys := strings.Split(strings.TrimPrefix(key, "/"), "/")
 	tKey := keys[len(keys)-1]
 	tb, err := base64.URLEncoding.DecodeString(tKey)
 	if err != nil {
-		return false
+		return time.Time{}, false
 	}
 
 	t := time.Time{}
 	if err := t.UnmarshalBinary(tb); err != nil {
-		return false
+		return time.Time{}, false
 	}
-	isUTC := t.Location().String() == time.UTC.String()
-	isBefore := t.Before(time.Now().UTC())
-	return isUTC && isBefore
+	return t, true
 }
 
 type IUpdatableStore interface {
 	IStore
 	QueryAll(...query.Query) (query.Results, error)
+	QueryAllContext(context.Context, ...query.Query) (query.Results, error)
 }
 
 type updatableStore struct {
@@ -103,8 +113,11 @@ type updatableStore struct {
 }
 
 func (cv *crdtVerse) NewUpdatableStore(name string, opts ...*StoreOpts) (IUpdatableStore, error) {
+	return cv.newUpdatableStore(context.Background(), name, opts...)
+}
+func (cv *crdtVerse) newUpdatableStore(ctx context.Context, name string, opts ...*StoreOpts) (IUpdatableStore, error) {
 	st := &baseStore{}
-	if err := cv.initCRDT(name, newUpdatableValidator(st), st); err != nil {
+	if err := cv.initCRDT(ctx, name, "updatable", newUpdatableValidator(st), st, opts...); err != nil {
 		return nil, err
 	}
 
@@ -115,17 +128,31 @@ func (cv *crdtVerse) NewUpdatableStore(name string, opts ...*StoreOpts) (IUpdata
 }
 
 func (s *updatableStore) Put(key string, val []byte) error {
-	tb, err := time.Now().UTC().MarshalBinary()
+	return s.PutContext(s.ctx, key, val)
+}
+func (s *updatableStore) PutContext(ctx context.Context, key string, val []byte) error {
+	tKey, err := newTimeKey()
 	if err != nil {
 		return err
 	}
-	tKey := base64.URLEncoding.EncodeToString(tb)
 
 	key += "/" + tKey
-	return s.baseStore.Put(key, val)
+	return s.baseStore.PutContext(ctx, key, val)
+}
+
+//newTimeKey returns the tKey of a value put now.
+func newTimeKey() (string, error) {
+	tb, err := time.Now().UTC().MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(tb), nil
 }
 func (s *updatableStore) Get(key string) ([]byte, error) {
-	rs, err := s.baseStore.Query(query.Query{
+	return s.GetContext(s.ctx, key)
+}
+func (s *updatableStore) GetContext(ctx context.Context, key string) ([]byte, error) {
+	rs, err := s.baseStore.QueryContext(ctx, query.Query{
 		Prefix: "/" + key,
 		Orders: []query.Order{updatableOrder{}},
 		Limit:  1,
@@ -158,7 +185,10 @@ func (s *updatableStore) GetSize(key string) (int, error) {
 	return r.Size, nil
 }
 func (s *updatableStore) Has(key string) (bool, error) {
-	rs, err := s.baseStore.Query(query.Query{
+	return s.HasContext(s.ctx, key)
+}
+func (s *updatableStore) HasContext(ctx context.Context, key string) (bool, error) {
+	rs, err := s.baseStore.QueryContext(ctx, query.Query{
 		Prefix:   "/" + key,
 		Orders:   []query.Order{updatableOrder{}},
 		KeysOnly: true,
@@ -171,7 +201,7 @@ func (s *updatableStore) Has(key string) (bool, error) {
 	rs.Close()
 	return len(resList) > 0, err
 }
-func (s *updatableStore) baseQuery(qs ...query.Query) (query.Results, error) {
+func (s *updatableStore) baseQuery(ctx context.Context, qs ...query.Query) (query.Results, error) {
 	var q query.Query
 	if len(qs) == 0 {
 		q = query.Query{}
@@ -180,54 +210,48 @@ func (s *updatableStore) baseQuery(qs ...query.Query) (query.Results, error) {
 	}
 	// example: [Am, ..., A1, Bn, ..., B1, ...]
 	q.Orders = append(q.Orders, categoryOrder{}, updatableOrder{})
-	return s.baseStore.Query(q)
+	return s.baseStore.QueryContext(ctx, q)
 }
 func (s *updatableStore) Query(qs ...query.Query) (query.Results, error) {
-	rs, err := s.baseQuery(qs...)
+	return s.QueryContext(s.ctx, qs...)
+}
+func (s *updatableStore) QueryContext(ctx context.Context, qs ...query.Query) (query.Results, error) {
+	rs, err := s.baseQuery(ctx, qs...)
 	if err != nil {
 		return nil, err
 	}
 
 	cKey := ""
-	ch := make(chan query.Result)
-	go func() {
-		defer close(ch)
-		for r := range rs.Next() {
-			keys := strings.Split(strings.TrimPrefix(r.Key, "/"), "/")
-			if len(keys) < 2 {
-				continue
-			}
-			cKey2 := strings.Join(keys[:len(keys)-1], "/")
-			if cKey != cKey2 {
-				ch <- r
-				cKey = cKey2
-			}
+	return s.forward(ctx, rs, func(r query.Result) (query.Result, bool) {
+		keys := strings.Split(strings.TrimPrefix(r.Key, "/"), "/")
+		if len(keys) < 2 {
+			return r, false
+		}
+		cKey2 := strings.Join(keys[:len(keys)-1], "/")
+		if cKey == cKey2 {
+			return r, false
 		}
-	}()
-	return query.ResultsWithChan(query.Query{}, ch), nil
+		cKey = cKey2
+		return r, true
+	}), nil
 }
 func (s *updatableStore) QueryAll(qs ...query.Query) (query.Results, error) {
-	rs, err := s.baseQuery(qs...)
+	return s.QueryAllContext(s.ctx, qs...)
+}
+func (s *updatableStore) QueryAllContext(ctx context.Context, qs ...query.Query) (query.Results, error) {
+	rs, err := s.baseQuery(ctx, qs...)
 	if err != nil {
 		return nil, err
 	}
 
-	ch := make(chan query.Result)
-	go func() {
-		defer close(ch)
-		for r := range rs.Next() {
-			keys := strings.Split(strings.TrimPrefix(r.Key, "/"), "/")
-			if len(keys) < 2 {
-				continue
-			}
-			ch <- r
-		}
-	}()
-	return query.ResultsWithChan(query.Query{}, ch), nil
+	return s.forward(ctx, rs, func(r query.Result) (query.Result, bool) {
+		keys := strings.Split(strings.TrimPrefix(r.Key, "/"), "/")
+		return r, len(keys) >= 2
+	}), nil
 }
 
-func (s *updatableStore) initPut() error {
-	return s.Put(s.name, []byte(s.name))
+func (s *updatableStore) initPut(ctx context.Context) error {
+	return s.PutContext(ctx, s.name, []byte(s.name))
 }
 func (s *updatableStore) loadCheck() bool {
 	if !s.inTime {
@@ -1,17 +1,19 @@
 package crdtverse
 
 import (
+	"context"
 	"errors"
 	"strings"
 	"time"
 
+	ds "github.com/ipfs/go-datastore"
 	query "github.com/ipfs/go-datastore/query"
 	pb "github.com/pilinsin/p2p-verse/crdt/pb"
 	proto "google.golang.org/protobuf/proto"
 )
 
-func newUpdatableSignatureValidator(s IStore) iValidator {
-	return &updatableValidator{newSignatureValidator(s)}
+func newUpdatableSignatureValidator(s IStore, legacy bool) iValidator {
+	return &updatableValidator{newSignatureValidator(s, legacy)}
 }
 
 func getUpdatableSignatureOpts(opts ...*StoreOpts) (IPrivKey, IPubKey, time.Time) {
@@ -37,12 +39,18 @@ type updatableSignatureStore struct {
 }
 
 func (cv *crdtVerse) NewUpdatableSignatureStore(name string, opts ...*StoreOpts) (IUpdatableSignatureStore, error) {
+	return cv.newUpdatableSignatureStore(context.Background(), name, opts...)
+}
+func (cv *crdtVerse) newUpdatableSignatureStore(ctx context.Context, name string, opts ...*StoreOpts) (IUpdatableSignatureStore, error) {
 	st := &baseStore{}
-	if err := cv.initCRDT(name, newUpdatableSignatureValidator(st), st); err != nil {
+	if err := cv.initCRDT(ctx, name, "updatableSignature", newUpdatableSignatureValidator(st, acceptsLegacySignatures(opts...)), st, opts...); err != nil {
 		return nil, err
 	}
 
 	priv, pub, tl := getUpdatableSignatureOpts(opts...)
+	if len(opts) > 0 {
+		st.salt = opts[0].Salt
+	}
 	st.timeLimit = tl
 	st.setTimeLimit()
 	return &updatableSignatureStore{&updatableStore{st}, priv, pub}, nil
@@ -57,33 +65,69 @@ func (s *updatableSignatureStore) ResetKeyPair(priv IPrivKey, pub IPubKey) {
 }
 
 func (s *updatableSignatureStore) Put(key string, val []byte) error {
-	if s.priv == nil {
-		return errors.New("no valid privKey")
+	return s.PutContext(s.ctx, key, val)
+}
+func (s *updatableSignatureStore) PutContext(ctx context.Context, key string, val []byte) error {
+	sKey := PubKeyToStr(s.pub)
+	if sKey == "" {
+		return errors.New("invalid pubKey")
 	}
-
-	sign, err := s.priv.Sign(val)
+	tKey, err := newTimeKey()
 	if err != nil {
 		return err
 	}
-	sd := &pb.SignatureData{
-		Value: val,
-		Sign:  sign,
-	}
-	msd, err := proto.Marshal(sd)
+	//the signature covers the tKey
+	key = sKey + "/" + key + "/" + tKey
+
+	msd, err := signValue(s.priv, s.Address(), key, val)
 	if err != nil {
 		return err
 	}
+	return s.baseStore.PutContext(ctx, key, msd)
+}
+func (s *updatableSignatureStore) MigrateSignatures() error {
+	return s.MigrateSignaturesContext(s.ctx)
+}
+func (s *updatableSignatureStore) MigrateSignaturesContext(ctx context.Context) error {
+	return s.migrateSignatures(ctx, s.priv, s.pub)
+}
 
+//Delete removes all the versions of the value.
+func (s *updatableSignatureStore) Delete(key string) error {
+	return s.DeleteContext(s.ctx, key)
+}
+func (s *updatableSignatureStore) DeleteContext(ctx context.Context, key string) error {
 	sKey := PubKeyToStr(s.pub)
 	if sKey == "" {
 		return errors.New("invalid pubKey")
 	}
+	key = ds.NewKey(sKey + "/" + key).String()
 
-	key = sKey + "/" + key
-	return s.updatableStore.Put(key, msd)
+	rs, err := s.baseStore.QueryContext(ctx, query.Query{
+		Prefix:   key,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	resList, err := rs.Rest()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(resList))
+	for _, res := range resList {
+		//<key>/<tKey>
+		if ds.NewKey(res.Key).Parent().String() == key {
+			keys = append(keys, res.Key)
+		}
+	}
+	return s.deleteKeys(ctx, s.priv, keys...)
 }
 func (s *updatableSignatureStore) Get(key string) ([]byte, error) {
-	msd, err := s.updatableStore.Get(key)
+	return s.GetContext(s.ctx, key)
+}
+func (s *updatableSignatureStore) GetContext(ctx context.Context, key string) ([]byte, error) {
+	msd, err := s.updatableStore.GetContext(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -101,8 +145,8 @@ func (s *updatableSignatureStore) GetSize(key string) (int, error) {
 	return len(val), nil
 }
 
-func (s *updatableSignatureStore) baseQuery(q query.Query) (query.Results, error) {
-	rs, err := s.updatableStore.Query(q)
+func (s *updatableSignatureStore) baseQuery(ctx context.Context, q query.Query) (query.Results, error) {
+	rs, err := s.updatableStore.QueryContext(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -110,22 +154,20 @@ func (s *updatableSignatureStore) baseQuery(q query.Query) (query.Results, error
 		return rs, nil
 	}
 
-	ch := make(chan query.Result)
-	go func() {
-		defer close(ch)
-		for r := range rs.Next() {
-			sd := &pb.SignatureData{}
-			if err := proto.Unmarshal(r.Value, sd); err != nil {
-				continue
-			}
-
-			r.Value = sd.GetValue()
-			ch <- r
+	return s.forward(ctx, rs, func(r query.Result) (query.Result, bool) {
+		sd := &pb.SignatureData{}
+		if err := proto.Unmarshal(r.Value, sd); err != nil {
+			return r, false
 		}
-	}()
-	return query.ResultsWithChan(query.Query{}, ch), nil
+
+		r.Value = sd.GetValue()
+		return r, true
+	}), nil
 }
 func (s *updatableSignatureStore) Query(qs ...query.Query) (query.Results, error) {
+	return s.QueryContext(s.ctx, qs...)
+}
+func (s *updatableSignatureStore) QueryContext(ctx context.Context, qs ...query.Query) (query.Results, error) {
 	var q query.Query
 	if len(qs) == 0 {
 		q = query.Query{}
@@ -133,11 +175,11 @@ func (s *updatableSignatureStore) Query(qs ...query.Query) (query.Results, error
 		q = qs[0]
 	}
 
-	return s.baseQuery(q)
+	return s.baseQuery(ctx, q)
 }
 
-func (s *updatableSignatureStore) baseQueryAll(q query.Query) (query.Results, error) {
-	rs, err := s.updatableStore.QueryAll(q)
+func (s *updatableSignatureStore) baseQueryAll(ctx context.Context, q query.Query) (query.Results, error) {
+	rs, err := s.updatableStore.QueryAllContext(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -145,22 +187,20 @@ func (s *updatableSignatureStore) baseQueryAll(q query.Query) (query.Results, er
 		return rs, nil
 	}
 
-	ch := make(chan query.Result)
-	go func() {
-		defer close(ch)
-		for r := range rs.Next() {
-			sd := &pb.SignatureData{}
-			if err := proto.Unmarshal(r.Value, sd); err != nil {
-				continue
-			}
-
-			r.Value = sd.GetValue()
-			ch <- r
+	return s.forward(ctx, rs, func(r query.Result) (query.Result, bool) {
+		sd := &pb.SignatureData{}
+		if err := proto.Unmarshal(r.Value, sd); err != nil {
+			return r, false
 		}
-	}()
-	return query.ResultsWithChan(query.Query{}, ch), nil
+
+		r.Value = sd.GetValue()
+		return r, true
+	}), nil
 }
 func (s *updatableSignatureStore) QueryAll(qs ...query.Query) (query.Results, error) {
+	return s.QueryAllContext(s.ctx, qs...)
+}
+func (s *updatableSignatureStore) QueryAllContext(ctx context.Context, qs ...query.Query) (query.Results, error) {
 	var q query.Query
 	if len(qs) == 0 {
 		q = query.Query{}
@@ -168,7 +208,7 @@ func (s *updatableSignatureStore) QueryAll(qs ...query.Query) (query.Results, er
 		q = qs[0]
 	}
 
-	return s.baseQueryAll(q)
+	return s.baseQueryAll(ctx, q)
 }
 
 func (s *updatableSignatureStore) accessFromKey(key string) string {
@@ -185,38 +225,28 @@ func (s *updatableSignatureStore) putKey(key string) string {
 	}
 	return sKey + "/" + key
 }
-func (s *updatableSignatureStore) acQuery(acKey string) (query.Results, error) {
-	return s.Query(query.Query{
+func (s *updatableSignatureStore) acQuery(ctx context.Context, acKey string) (query.Results, error) {
+	return s.QueryContext(ctx, query.Query{
 		Filters: []query.Filter{KeyExistFilter{Key: acKey}},
 	})
 }
 
-func (s *updatableSignatureStore) initPut() error {
-	if s.priv == nil {
-		return errors.New("no valid privKey")
+func (s *updatableSignatureStore) initPut(ctx context.Context) error {
+	sKey := PubKeyToStr(s.pub)
+	if sKey == "" {
+		return errors.New("invalid pubKey")
 	}
-
-	val := []byte(s.name)
-	sign, err := s.priv.Sign(val)
+	tKey, err := newTimeKey()
 	if err != nil {
 		return err
 	}
-	sd := &pb.SignatureData{
-		Value: val,
-		Sign:  sign,
-	}
-	msd, err := proto.Marshal(sd)
+	key := sKey + "/" + s.name + "/" + tKey
+
+	msd, err := signValue(s.priv, s.Address(), key, []byte(s.name))
 	if err != nil {
 		return err
 	}
-
-	sKey := PubKeyToStr(s.pub)
-	if sKey == "" {
-		return errors.New("invalid pubKey")
-	}
-
-	key := sKey + "/" + s.name
-	return s.updatableStore.Put(key, msd)
+	return s.baseStore.PutContext(ctx, key, msd)
 }
 func (s *updatableSignatureStore) loadCheck() bool {
 	if !s.inTime {
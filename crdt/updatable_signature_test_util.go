@@ -58,6 +58,20 @@ func BaseTestUpdatableSignatureStore(t *testing.T, hGen pv.HostGenerator) {
 		t.Log(string(res.Value))
 	}
 
+	checkError(t, db0.(ISignatureStore).Delete("aaa"))
+	assertError(t, db1.(ISignatureStore).Delete("aaa") != nil, "Delete of others' key must be fail")
+	t.Log("delete done")
+	time.Sleep(time.Second * 10)
+
+	ok, err = db1.Has(PubKeyToStr(opts0.Pub) + "/aaa")
+	checkError(t, err)
+	assertError(t, !ok, "the deleted key must not exist")
+	rs13, err := db1.Query()
+	checkError(t, err)
+	for res := range rs13.Next() {
+		assertError(t, !isTombstoneKey(res.Key), "deletion records must not be queried")
+	}
+
 	db0.Close()
 	db1.Close()
 	time.Sleep(time.Second)
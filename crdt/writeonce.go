@@ -0,0 +1,128 @@
+package crdtverse
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+//writeOnceStore is the datastore of the crdt of a store which is not deletable,
+//so that the first value of a key is kept on every replica.
+//go-ds-crdt keeps the value of the highest priority, i.e. the latest height in the dag, or the greater one of the same priority,
+//and then a concurrent write of an existing key would replace the first value.
+//writeOnceStore hides the priorities from go-ds-crdt, which then writes every value with its priority,
+//and keeps the value of the lowest priority, or the smaller one of the same priority.
+//the values and the priorities are kept at /<name>/s/k/<key>/v and /<name>/s/k/<key>/p by go-ds-crdt.
+type writeOnceStore struct {
+	ds.Batching
+	prefix string
+}
+
+func newWriteOnceStore(d ds.Batching, name string) *writeOnceStore {
+	return &writeOnceStore{d, ds.NewKey(name).ChildString("s").ChildString("k").String() + "/"}
+}
+
+//split returns the key of a value or a priority of go-ds-crdt and its suffix.
+func (d *writeOnceStore) split(key ds.Key) (string, string, bool) {
+	if !strings.HasPrefix(key.String(), d.prefix) {
+		return "", "", false
+	}
+	suffix := key.BaseNamespace()
+	if suffix != "v" && suffix != "p" {
+		return "", "", false
+	}
+	return key.Parent().String(), suffix, true
+}
+
+func (d *writeOnceStore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	if _, suffix, ok := d.split(key); ok && suffix == "p" {
+		return nil, ds.ErrNotFound
+	}
+	return d.Batching.Get(ctx, key)
+}
+
+//go-ds-crdt puts the values in a batch if the datastore is ds.Batching.
+func (d *writeOnceStore) Batch(ctx context.Context) (ds.Batch, error) {
+	b, err := d.Batching.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &writeOnceBatch{
+		Batch:   b,
+		d:       d,
+		values:  make(map[string][]byte),
+		written: make(map[string]firstWrite),
+	}, nil
+}
+
+type firstWrite struct {
+	prio  []byte
+	value []byte
+}
+
+//before reports whether w is before cur, i.e. w has the lower priority, or the smaller value of the same priority.
+func (w firstWrite) before(cur firstWrite) bool {
+	prio, _ := binary.Uvarint(w.prio)
+	curPrio, _ := binary.Uvarint(cur.prio)
+	if prio != curPrio {
+		return prio < curPrio
+	}
+	return bytes.Compare(w.value, cur.value) < 0
+}
+
+//writeOnceBatch puts a value with its priority only if it is before the current one,
+//which is the one written in the batch or the one in the datastore.
+//go-ds-crdt puts a value and then its priority.
+type writeOnceBatch struct {
+	ds.Batch
+	d       *writeOnceStore
+	values  map[string][]byte
+	written map[string]firstWrite
+}
+
+func (b *writeOnceBatch) Put(ctx context.Context, key ds.Key, val []byte) error {
+	base, suffix, ok := b.d.split(key)
+	if !ok {
+		return b.Batch.Put(ctx, key, val)
+	}
+	if suffix == "v" {
+		b.values[base] = val
+		return nil
+	}
+
+	w := firstWrite{val, b.values[base]}
+	delete(b.values, base)
+	cur, ok, err := b.current(ctx, base)
+	if err != nil {
+		return err
+	}
+	if ok && !w.before(cur) {
+		return nil
+	}
+	b.written[base] = w
+	if err := b.Batch.Put(ctx, ds.NewKey(base).ChildString("v"), w.value); err != nil {
+		return err
+	}
+	return b.Batch.Put(ctx, key, w.prio)
+}
+
+func (b *writeOnceBatch) current(ctx context.Context, base string) (firstWrite, bool, error) {
+	if w, ok := b.written[base]; ok {
+		return w, true, nil
+	}
+	prio, err := b.d.Batching.Get(ctx, ds.NewKey(base).ChildString("p"))
+	if err == ds.ErrNotFound {
+		return firstWrite{}, false, nil
+	}
+	if err != nil {
+		return firstWrite{}, false, err
+	}
+	value, err := b.d.Batching.Get(ctx, ds.NewKey(base).ChildString("v"))
+	if err != nil {
+		return firstWrite{}, false, err
+	}
+	return firstWrite{prio, value}, true, nil
+}
@@ -0,0 +1,265 @@
+package p2pverse
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	discovery "github.com/libp2p/go-libp2p-core/discovery"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	kad "github.com/libp2p/go-libp2p-kad-dht"
+	mdns "github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	routing "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	multierr "go.uber.org/multierr"
+)
+
+//Discoverer is a peer discovery backend.
+//It is also accepted by p2ppubsub.WithDiscovery.
+type Discoverer interface {
+	discovery.Discovery
+}
+
+//DiscovererGenerator creates a Discoverer for a host created by a HostGenerator.
+type DiscovererGenerator func(host.Host) (Discoverer, error)
+
+//a namespaceAgnostic Discoverer finds the same peers for every keyword.
+//DiscoveryDHT connects to its peers, but does not count them as the peers of a keyword.
+type namespaceAgnostic interface {
+	namespaceAgnostic()
+}
+
+func isNamespaceAgnostic(disc Discoverer) bool {
+	_, ok := disc.(namespaceAgnostic)
+	return ok
+}
+
+func NewDHTDiscoverer(d *kad.IpfsDHT) Discoverer {
+	return routing.NewRoutingDiscovery(d)
+}
+
+type mdnsDiscoverer struct {
+	service mdns.Service
+	mutex   sync.Mutex
+	peers   map[peer.ID]peer.AddrInfo
+}
+
+//NewMdnsDiscoverer finds the peers in the LAN which run the mDNS service of the same serviceName.
+//The default service name of libp2p is used if serviceName is empty.
+//The Discoverer is namespace-agnostic, i.e. it finds the same peers for every keyword,
+//so the peers are connected but not counted in KeywordPeers and DiscoveryEvents.
+func NewMdnsDiscoverer(h host.Host, serviceName string) (Discoverer, error) {
+	md := &mdnsDiscoverer{peers: make(map[peer.ID]peer.AddrInfo)}
+	md.service = mdns.NewMdnsService(h, serviceName, md)
+	if err := md.service.Start(); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+func MdnsGenerator(serviceName string) DiscovererGenerator {
+	return func(h host.Host) (Discoverer, error) {
+		return NewMdnsDiscoverer(h, serviceName)
+	}
+}
+func (md *mdnsDiscoverer) HandlePeerFound(ai peer.AddrInfo) {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+	md.peers[ai.ID] = ai
+}
+func (md *mdnsDiscoverer) Close() error {
+	return md.service.Close()
+}
+func (md *mdnsDiscoverer) namespaceAgnostic() {}
+
+//Advertise does nothing, since the mDNS service announces the host without ns until it is closed.
+func (md *mdnsDiscoverer) Advertise(ctx context.Context, ns string, opts ...discovery.Option) (time.Duration, error) {
+	return advertisedTTL(opts...)
+}
+func (md *mdnsDiscoverer) FindPeers(ctx context.Context, ns string, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	md.mutex.Lock()
+	ais := make([]peer.AddrInfo, 0, len(md.peers))
+	for _, ai := range md.peers {
+		ais = append(ais, ai)
+	}
+	md.mutex.Unlock()
+	return sendPeers(ctx, ais, opts...)
+}
+
+type staticDiscoverer struct {
+	peers []peer.AddrInfo
+}
+
+//NewStaticDiscoverer finds the given peers for every keyword.
+//The Discoverer is namespace-agnostic as the one of NewMdnsDiscoverer.
+func NewStaticDiscoverer(ais ...peer.AddrInfo) Discoverer {
+	return &staticDiscoverer{ais}
+}
+
+//NewStaticDiscovererFromString accepts the strings of ParseAddrInfos.
+func NewStaticDiscovererFromString(sais string) (Discoverer, error) {
+	ais, err := ParseAddrInfos(sais)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticDiscoverer(ais...), nil
+}
+func StaticGenerator(ais ...peer.AddrInfo) DiscovererGenerator {
+	return func(host.Host) (Discoverer, error) {
+		return NewStaticDiscoverer(ais...), nil
+	}
+}
+func (sd *staticDiscoverer) namespaceAgnostic() {}
+
+//Advertise does nothing, since the peers are given.
+func (sd *staticDiscoverer) Advertise(ctx context.Context, ns string, opts ...discovery.Option) (time.Duration, error) {
+	return advertisedTTL(opts...)
+}
+func (sd *staticDiscoverer) FindPeers(ctx context.Context, ns string, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	return sendPeers(ctx, sd.peers, opts...)
+}
+
+func advertisedTTL(opts ...discovery.Option) (time.Duration, error) {
+	var options discovery.Options
+	if err := options.Apply(opts...); err != nil {
+		return 0, err
+	}
+	if options.Ttl <= 0 {
+		return time.Hour * 3, nil
+	}
+	return options.Ttl, nil
+}
+func sendPeers(ctx context.Context, ais []peer.AddrInfo, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	var options discovery.Options
+	if err := options.Apply(opts...); err != nil {
+		return nil, err
+	}
+	if options.Limit > 0 && options.Limit < len(ais) {
+		ais = ais[:options.Limit]
+	}
+
+	ch := make(chan peer.AddrInfo, len(ais))
+	for _, ai := range ais {
+		ch <- ai
+	}
+	close(ch)
+	return ch, nil
+}
+
+//multiDiscoverer advertises to and finds peers from all of its Discoverers.
+type multiDiscoverer struct {
+	mutex sync.Mutex
+	discs []Discoverer
+}
+
+func newMultiDiscoverer(discs ...Discoverer) *multiDiscoverer {
+	return &multiDiscoverer{discs: discs}
+}
+func (md *multiDiscoverer) add(disc Discoverer) {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+	md.discs = append(md.discs, disc)
+}
+func (md *multiDiscoverer) list() []Discoverer {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+	discs := make([]Discoverer, len(md.discs))
+	copy(discs, md.discs)
+	return discs
+}
+func (md *multiDiscoverer) len() int {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+	return len(md.discs)
+}
+func (md *multiDiscoverer) close() error {
+	var err error
+	for _, disc := range md.list() {
+		if c, ok := disc.(io.Closer); ok {
+			err = multierr.Append(err, c.Close())
+		}
+	}
+	return err
+}
+
+//the shortest TTL is returned. an error is returned only if all Discoverers fail.
+func (md *multiDiscoverer) Advertise(ctx context.Context, ns string, opts ...discovery.Option) (time.Duration, error) {
+	var ttl time.Duration
+	var lastErr error
+	nSuccess := 0
+	for _, disc := range md.list() {
+		t, err := disc.Advertise(ctx, ns, opts...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if nSuccess == 0 || t < ttl {
+			ttl = t
+		}
+		nSuccess++
+	}
+	if nSuccess == 0 && lastErr != nil {
+		return 0, lastErr
+	}
+	return ttl, nil
+}
+func (md *multiDiscoverer) FindPeers(ctx context.Context, ns string, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	return findAllPeers(ctx, md.list(), ns, opts...)
+}
+
+//findPeers is FindPeers of the namespace-agnostic Discoverers if agnostic, or of the others if not.
+func (md *multiDiscoverer) findPeers(ctx context.Context, ns string, agnostic bool, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	discs := make([]Discoverer, 0)
+	for _, disc := range md.list() {
+		if isNamespaceAgnostic(disc) == agnostic {
+			discs = append(discs, disc)
+		}
+	}
+	return findAllPeers(ctx, discs, ns, opts...)
+}
+
+//an error is returned only if all discs fail.
+func findAllPeers(ctx context.Context, discs []Discoverer, ns string, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
+	chs := make([]<-chan peer.AddrInfo, 0)
+	var lastErr error
+	for _, disc := range discs {
+		ch, err := disc.FindPeers(ctx, ns, opts...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		chs = append(chs, ch)
+	}
+	if len(chs) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	out := make(chan peer.AddrInfo)
+	var wg sync.WaitGroup
+	for _, ch := range chs {
+		wg.Add(1)
+		go func(ch <-chan peer.AddrInfo) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ai, ok := <-ch:
+					if !ok {
+						return
+					}
+					select {
+					case <-ctx.Done():
+						return
+					case out <- ai:
+					}
+				}
+			}
+		}(ch)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out, nil
+}
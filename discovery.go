@@ -3,26 +3,29 @@ package p2pverse
 import (
 	"context"
 	"errors"
-	"fmt"
 	"sync"
 
-	discovery "github.com/libp2p/go-libp2p-core/discovery"
 	host "github.com/libp2p/go-libp2p-core/host"
 	network "github.com/libp2p/go-libp2p-core/network"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	kad "github.com/libp2p/go-libp2p-kad-dht"
 	routing "github.com/libp2p/go-libp2p/p2p/discovery/routing"
 	discutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+	multierr "go.uber.org/multierr"
 )
 
 func Discovery(h host.Host, keyword string, bootstraps []peer.AddrInfo) error {
-	ctx := context.Background()
-	d, err := kad.New(ctx, h)
+	return DiscoveryContext(context.Background(), h, keyword, bootstraps)
+}
+
+//the DHT used for the discovery runs until ctx is done.
+func DiscoveryContext(ctx context.Context, h host.Host, keyword string, bootstraps []peer.AddrInfo) error {
+	d, err := newKad(ctx, h)
 	if err != nil {
 		return err
 	}
 
-	if err := connectBootstraps(ctx, h, bootstraps); err != nil {
+	if err := connectBootstraps(ctx, h, bootstraps, DefaultLogger()); err != nil {
 		return err
 	}
 	if err := d.Bootstrap(ctx); err != nil {
@@ -53,14 +56,14 @@ func Discovery(h host.Host, keyword string, bootstraps []peer.AddrInfo) error {
 			continue
 		}
 		if err := h.Connect(ctx, peer); err != nil {
-			fmt.Println("connection err:", err)
+			DefaultLogger().Debug("connection failed", F("keyword", keyword), F("peer", peer.ID), F("error", err))
 		}
 		nSuccess++
 	}
 
 	return nil
 }
-func connectBootstraps(ctx context.Context, self host.Host, others []peer.AddrInfo) error {
+func connectBootstraps(ctx context.Context, self host.Host, others []peer.AddrInfo, logger Logger) error {
 	var cbErr error
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -75,7 +78,7 @@ func connectBootstraps(ctx context.Context, self host.Host, others []peer.AddrIn
 			if err := self.Connect(ctx, other); err == nil {
 				isSuccess = true
 			} else {
-				fmt.Println("connection err:", err)
+				logger.Warn("bootstrap connection failed", F("bootstrap", other.ID), F("error", err))
 			}
 		}
 		if !isSuccess {
@@ -88,48 +91,174 @@ func connectBootstraps(ctx context.Context, self host.Host, others []peer.AddrIn
 }
 
 type DiscoveryDHT struct {
-	ctx context.Context
-	h   host.Host
-	d   *kad.IpfsDHT
+	ctx    context.Context
+	cancel func()
+	h      host.Host
+	d      *kad.IpfsDHT
+	dm     *discoveryManager
+	discs  *multiDiscoverer
+	rc     *Reconnector
+	nb     network.Notifiee
+	wMutex sync.Mutex
+	wg     sync.WaitGroup
+	lMutex sync.RWMutex
+	logger Logger
 }
 
-func NewDHT(h host.Host) (*DiscoveryDHT, error) {
-	ctx := context.Background()
-	d, err := kad.New(ctx, h)
+//discs are used together with the DHT rendezvous.
+func NewDHT(h host.Host, discs ...Discoverer) (*DiscoveryDHT, error) {
+	return NewDHTContext(context.Background(), h, discs...)
+}
+
+//the DHT is closed when ctx is done.
+func NewDHTContext(ctx context.Context, h host.Host, discs ...Discoverer) (*DiscoveryDHT, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	d, err := newKad(ctx, h)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	return &DiscoveryDHT{ctx, h, d}, nil
+
+	dd := &DiscoveryDHT{
+		ctx:    ctx,
+		cancel: cancel,
+		h:      h,
+		d:      d,
+		dm:     newDiscoveryManager(),
+		discs:  newMultiDiscoverer(append([]Discoverer{NewDHTDiscoverer(d)}, discs...)...),
+		rc:     NewReconnector(ctx, h),
+	}
+	dd.nb = &network.NotifyBundle{
+		DisconnectedF: func(_ network.Network, conn network.Conn) {
+			dd.goFunc(func() { dd.peerDisconnected(conn.RemotePeer()) })
+		},
+	}
+	h.Network().Notify(dd.nb)
+	evCh := dd.rc.Subscribe(ctx)
+	dd.goFunc(func() { dd.rediscover(evCh) })
+	return dd, nil
+}
+
+//goFunc runs f in a goroutine which Close waits for.
+//f is not run and false is returned after the DHT is closed.
+func (d *DiscoveryDHT) goFunc(f func()) bool {
+	d.wMutex.Lock()
+	defer d.wMutex.Unlock()
+	if d.ctx.Err() != nil {
+		return false
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		f()
+	}()
+	return true
 }
-func (d *DiscoveryDHT) Close() {
-	d.d.Close()
-	d.h = nil
+
+//Close stops the discoveries and the Reconnector, and waits for their goroutines before closing the DHT.
+//The host is not closed.
+func (d *DiscoveryDHT) Close() error {
+	d.h.Network().StopNotify(d.nb)
+	d.rc.Close()
+	d.wMutex.Lock()
+	d.cancel()
+	d.wMutex.Unlock()
+	d.wg.Wait()
+
+	err := d.discs.close()
+	return multierr.Append(err, d.d.Close())
 }
 func (d *DiscoveryDHT) DHT() *kad.IpfsDHT {
 	return d.d
 }
-func (d *DiscoveryDHT) Discovery() discovery.Discovery {
-	return routing.NewRoutingDiscovery(d.d)
+
+//SetLogger replaces the Logger of the DHT, which is DefaultLogger by default.
+func (d *DiscoveryDHT) SetLogger(l Logger) {
+	if l == nil {
+		l = NopLogger()
+	}
+	d.lMutex.Lock()
+	defer d.lMutex.Unlock()
+	d.logger = l
+}
+func (d *DiscoveryDHT) Logger() Logger {
+	d.lMutex.RLock()
+	defer d.lMutex.RUnlock()
+	if d.logger == nil {
+		return DefaultLogger()
+	}
+	return d.logger
+}
+
+//Reconnector keeps the connections to the bootstraps given to Bootstrap.
+func (d *DiscoveryDHT) Reconnector() *Reconnector {
+	return d.rc
+}
+
+//ConnectedPeers returns the peers connected at the moment.
+func (d *DiscoveryDHT) ConnectedPeers() []peer.AddrInfo {
+	return connectedPeers(d.h)
+}
+
+//the events are sent until ctx is done or the DHT is closed.
+func (d *DiscoveryDHT) SubscribePeerEvents(ctx context.Context) (<-chan PeerEvent, error) {
+	return subscribePeerEvents(ctx, d.ctx, d.h)
+}
+
+//AddDiscoverer adds disc to the Discoverer returned by Discovery.
+//disc is closed with the DHT if it is an io.Closer.
+func (d *DiscoveryDHT) AddDiscoverer(disc Discoverer) {
+	d.discs.add(disc)
+}
+
+//Discovery advertises to and finds peers from the DHT rendezvous and all the added Discoverers.
+func (d *DiscoveryDHT) Discovery() Discoverer {
+	return d.discs
 }
 func (d *DiscoveryDHT) Bootstrap(keyword string, bootstraps []peer.AddrInfo) error {
-	if err := connectBootstraps(d.ctx, d.h, bootstraps); err != nil {
-		return err
+	return d.BootstrapContext(d.ctx, keyword, bootstraps)
+}
+
+//ctx bounds the connections and the first peer search.
+//keyword is discovered in the background with the default DiscoveryOpts until the DHT is closed.
+//The bootstraps are supervised by the Reconnector, so they do not have to be online at the moment.
+//If other Discoverers are added, no bootstrap has to be given.
+func (d *DiscoveryDHT) BootstrapContext(ctx context.Context, keyword string, bootstraps []peer.AddrInfo) error {
+	if len(bootstraps) == 0 && d.discs.len() <= 1 {
+		return errors.New("no bootstraps are given")
 	}
-	if err := d.d.Bootstrap(d.ctx); err != nil {
-		return err
+	d.rc.Add(bootstraps...)
+
+	//the first peer search is skipped if no peer is reachable, and is retried after a reconnection
+	if err := connectBootstraps(ctx, d.h, bootstraps, d.Logger()); err == nil || d.discs.len() > 1 {
+		if err := d.d.Bootstrap(ctx); err != nil {
+			return err
+		}
+		if err := d.ConnectPeers(ctx, keyword, 5); err != nil {
+			return err
+		}
 	}
+	d.dm.mutex.Lock()
+	_, ok := d.dm.keywords[keyword]
+	d.dm.mutex.Unlock()
+	if !ok {
+		d.StartDiscovery(keyword)
+	}
+	return nil
+}
 
-	routingDiscovery := routing.NewRoutingDiscovery(d.d)
-	discutil.Advertise(d.ctx, routingDiscovery, keyword)
-	peersCh, err := routingDiscovery.FindPeers(d.ctx, keyword)
+//ConnectPeers searches the peers advertising keyword and connects to at most maxPeers of them.
+func (d *DiscoveryDHT) ConnectPeers(ctx context.Context, keyword string, maxPeers int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	peersCh, err := d.Discovery().FindPeers(ctx, keyword)
 	if err != nil {
 		return err
 	}
 
 	nSuccess := 0
-	maxSuccess := 5
 	for peer := range peersCh {
-		if nSuccess >= maxSuccess {
+		if nSuccess >= maxPeers {
 			return nil
 		}
 
@@ -143,8 +272,8 @@ func (d *DiscoveryDHT) Bootstrap(keyword string, bootstraps []peer.AddrInfo) err
 			nSuccess++
 			continue
 		}
-		if err := d.h.Connect(d.ctx, peer); err != nil {
-			fmt.Println("connection err:", err)
+		if err := d.h.Connect(ctx, peer); err != nil {
+			d.Logger().Debug("connection failed", F("keyword", keyword), F("peer", peer.ID), F("error", err))
 		}
 		nSuccess++
 	}
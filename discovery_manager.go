@@ -0,0 +1,366 @@
+package p2pverse
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	discovery "github.com/libp2p/go-libp2p-core/discovery"
+	network "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+type DiscoveryOpts struct {
+	//FindPeers is rerun when less than Low peers of the keyword are connected (default: 3)
+	Low int
+	//a FindPeers pass stops when High peers of the keyword are connected (default: 10)
+	High int
+	//the interval of the connected peer check and of the retries of a failed advertisement (default: 10s)
+	Interval time.Duration
+	//the requested TTL of the advertisement, which is renewed at 7/8 of the returned TTL (default: 3h)
+	TTL time.Duration
+	//overrides the number of connected peers of the keyword, e.g. the peers of a pubsub topic
+	PeerCounter func() int
+}
+
+func getDiscoveryOpts(opts ...*DiscoveryOpts) *DiscoveryOpts {
+	opt := &DiscoveryOpts{}
+	if len(opts) > 0 && opts[0] != nil {
+		*opt = *opts[0]
+	}
+	if opt.Low <= 0 {
+		opt.Low = 3
+	}
+	if opt.High < opt.Low {
+		opt.High = opt.Low
+		if opt.High < 10 {
+			opt.High = 10
+		}
+	}
+	if opt.Interval <= 0 {
+		opt.Interval = time.Second * 10
+	}
+	if opt.TTL <= 0 {
+		opt.TTL = time.Hour * 3
+	}
+	return opt
+}
+
+type DiscoveryEvent struct {
+	Keyword   string
+	Peer      peer.ID
+	Connected bool
+}
+
+type keywordDiscovery struct {
+	cancel  func()
+	wg      sync.WaitGroup
+	trigger chan struct{}
+	opt     *DiscoveryOpts
+	mutex   sync.Mutex
+	peers   map[peer.ID]struct{}
+}
+
+func (kd *keywordDiscovery) add(pid peer.ID) bool {
+	kd.mutex.Lock()
+	defer kd.mutex.Unlock()
+	if _, ok := kd.peers[pid]; ok {
+		return false
+	}
+	kd.peers[pid] = struct{}{}
+	return true
+}
+func (kd *keywordDiscovery) remove(pid peer.ID) bool {
+	kd.mutex.Lock()
+	defer kd.mutex.Unlock()
+	if _, ok := kd.peers[pid]; !ok {
+		return false
+	}
+	delete(kd.peers, pid)
+	return true
+}
+func (kd *keywordDiscovery) list() []peer.ID {
+	kd.mutex.Lock()
+	defer kd.mutex.Unlock()
+	pids := make([]peer.ID, 0, len(kd.peers))
+	for pid := range kd.peers {
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+type discoveryManager struct {
+	mutex    sync.Mutex
+	keywords map[string]*keywordDiscovery
+	subs     map[chan DiscoveryEvent]struct{}
+}
+
+func newDiscoveryManager() *discoveryManager {
+	return &discoveryManager{
+		keywords: make(map[string]*keywordDiscovery),
+		subs:     make(map[chan DiscoveryEvent]struct{}),
+	}
+}
+
+//events are dropped for a subscriber whose channel is full.
+func (m *discoveryManager) emit(ev DiscoveryEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for ch := range m.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+//StartDiscovery advertises keyword and keeps the connected peers of keyword between the watermarks of opts
+//until StopDiscovery is called or the DHT is closed.
+//If keyword is already discovered, it is restarted with opts.
+func (d *DiscoveryDHT) StartDiscovery(keyword string, opts ...*DiscoveryOpts) {
+	ctx, cancel := context.WithCancel(d.ctx)
+	kd := &keywordDiscovery{
+		cancel:  cancel,
+		trigger: make(chan struct{}, 1),
+		opt:     getDiscoveryOpts(opts...),
+		peers:   make(map[peer.ID]struct{}),
+	}
+	fs := []func(){
+		func() { d.advertise(ctx, keyword, kd.opt) },
+		func() { d.keepPeers(ctx, keyword, kd) },
+	}
+
+	//the previous discovery is replaced and started in the lock,
+	//so that concurrent calls for the same keyword stop each other's discovery.
+	d.dm.mutex.Lock()
+	old, ok := d.dm.keywords[keyword]
+	d.dm.keywords[keyword] = kd
+	kd.wg.Add(len(fs))
+	for _, f := range fs {
+		f := f
+		if !d.goFunc(func() { defer kd.wg.Done(); f() }) {
+			kd.wg.Done()
+		}
+	}
+	d.dm.mutex.Unlock()
+
+	if ok {
+		old.cancel()
+		old.wg.Wait()
+	}
+}
+
+//StopDiscovery stops advertising and discovering keyword, and waits for the running search.
+func (d *DiscoveryDHT) StopDiscovery(keyword string) {
+	d.dm.mutex.Lock()
+	kd, ok := d.dm.keywords[keyword]
+	delete(d.dm.keywords, keyword)
+	d.dm.mutex.Unlock()
+	if ok {
+		kd.cancel()
+		kd.wg.Wait()
+	}
+}
+
+//KeywordPeers returns the connected peers found through keyword.
+func (d *DiscoveryDHT) KeywordPeers(keyword string) []peer.ID {
+	d.dm.mutex.Lock()
+	kd, ok := d.dm.keywords[keyword]
+	d.dm.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	return kd.list()
+}
+
+//SubscribeDiscovery returns the connect and disconnect events of the discovered peers until ctx is done.
+func (d *DiscoveryDHT) SubscribeDiscovery(ctx context.Context) <-chan DiscoveryEvent {
+	ch := make(chan DiscoveryEvent, 32)
+	d.dm.mutex.Lock()
+	d.dm.subs[ch] = struct{}{}
+	d.dm.mutex.Unlock()
+
+	unsubscribe := func() {
+		d.dm.mutex.Lock()
+		delete(d.dm.subs, ch)
+		d.dm.mutex.Unlock()
+		close(ch)
+	}
+	ok := d.goFunc(func() {
+		select {
+		case <-ctx.Done():
+		case <-d.ctx.Done():
+		}
+		unsubscribe()
+	})
+	if !ok {
+		unsubscribe()
+	}
+	return ch
+}
+
+func (d *DiscoveryDHT) advertise(ctx context.Context, keyword string, opt *DiscoveryOpts) {
+	disc := d.Discovery()
+	for {
+		aTTL, err := disc.Advertise(ctx, keyword, discovery.TTL(opt.TTL))
+		wait := 7 * aTTL / 8
+		if err != nil {
+			d.Logger().Debug("advertisement failed", F("keyword", keyword), F("error", err))
+			wait = opt.Interval
+		}
+		//a Discoverer may return a zero TTL, e.g. the mDNS and static Discoverers
+		if wait < opt.Interval {
+			wait = opt.Interval
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (d *DiscoveryDHT) keepPeers(ctx context.Context, keyword string, kd *keywordDiscovery) {
+	ticker := time.NewTicker(kd.opt.Interval)
+	defer ticker.Stop()
+	for {
+		if n := d.countPeers(kd); n < kd.opt.Low {
+			d.findPeers(ctx, keyword, kd, kd.opt.High-n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-kd.trigger:
+		}
+	}
+}
+func (d *DiscoveryDHT) countPeers(kd *keywordDiscovery) int {
+	if kd.opt.PeerCounter != nil {
+		return kd.opt.PeerCounter()
+	}
+	return len(kd.list())
+}
+func (d *DiscoveryDHT) findPeers(ctx context.Context, keyword string, kd *keywordDiscovery, maxPeers int) {
+	d.connectAgnosticPeers(ctx, keyword, maxPeers)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	peersCh, err := d.discs.findPeers(ctx, keyword, false)
+	if err != nil {
+		return
+	}
+	defer drainPeers(cancel, peersCh)
+
+	nSuccess := 0
+	for ai := range peersCh {
+		if nSuccess >= maxPeers {
+			return
+		}
+		if ai.ID == d.h.ID() || len(ai.Addrs) <= 0 {
+			continue
+		}
+		if d.h.Network().Connectedness(ai.ID) != network.Connected {
+			if err := d.h.Connect(ctx, ai); err != nil {
+				continue
+			}
+		}
+		nSuccess++
+		if kd.add(ai.ID) {
+			d.dm.emit(DiscoveryEvent{keyword, ai.ID, true})
+		}
+	}
+}
+
+//the peers of the namespace-agnostic Discoverers are connected, but they are not the peers of keyword.
+func (d *DiscoveryDHT) connectAgnosticPeers(ctx context.Context, keyword string, maxPeers int) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	peersCh, err := d.discs.findPeers(ctx, keyword, true)
+	if err != nil {
+		return
+	}
+	defer drainPeers(cancel, peersCh)
+
+	nSuccess := 0
+	for ai := range peersCh {
+		if nSuccess >= maxPeers {
+			return
+		}
+		if ai.ID == d.h.ID() || len(ai.Addrs) <= 0 {
+			continue
+		}
+		if d.h.Network().Connectedness(ai.ID) != network.Connected {
+			if err := d.h.Connect(ctx, ai); err != nil {
+				continue
+			}
+		}
+		nSuccess++
+	}
+}
+
+//drainPeers cancels a search and waits until its goroutines close peersCh,
+//so that they are finished within the goroutine of the discovery.
+func drainPeers(cancel func(), peersCh <-chan peer.AddrInfo) {
+	cancel()
+	for range peersCh {
+	}
+}
+
+//rediscover refreshes the routing table and the discovered keywords whenever a bootstrap is reconnected.
+//a reconnection is logged at the info level only if the connection was lost or failed before,
+//since the first connection of every bootstrap is also a reconnection.
+func (d *DiscoveryDHT) rediscover(evCh <-chan ReconnectEvent) {
+	connected := make(map[peer.ID]bool)
+	for ev := range evCh {
+		if !ev.Connected {
+			d.Logger().Debug("bootstrap reconnection failed", F("bootstrap", ev.Peer), F("attempt", ev.Attempt), F("backoff", ev.Backoff), F("error", ev.Err))
+			continue
+		}
+		if connected[ev.Peer] || ev.Attempt > 1 {
+			d.Logger().Info("bootstrap reconnected", F("bootstrap", ev.Peer), F("attempt", ev.Attempt))
+		} else {
+			d.Logger().Debug("bootstrap connected", F("bootstrap", ev.Peer), F("attempt", ev.Attempt))
+		}
+		connected[ev.Peer] = true
+		d.d.RefreshRoutingTable()
+
+		d.dm.mutex.Lock()
+		for _, kd := range d.dm.keywords {
+			select {
+			case kd.trigger <- struct{}{}:
+			default:
+			}
+		}
+		d.dm.mutex.Unlock()
+	}
+}
+
+//peerDisconnected is called by the network notifiee of the DHT.
+func (d *DiscoveryDHT) peerDisconnected(pid peer.ID) {
+	if d.h.Network().Connectedness(pid) == network.Connected {
+		return
+	}
+
+	d.dm.mutex.Lock()
+	kds := make(map[string]*keywordDiscovery, len(d.dm.keywords))
+	for keyword, kd := range d.dm.keywords {
+		kds[keyword] = kd
+	}
+	d.dm.mutex.Unlock()
+
+	for keyword, kd := range kds {
+		if !kd.remove(pid) {
+			continue
+		}
+		d.dm.emit(DiscoveryEvent{keyword, pid, false})
+		select {
+		case kd.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package p2pverse
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	control "github.com/libp2p/go-libp2p-core/control"
+	host "github.com/libp2p/go-libp2p-core/host"
+	network "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	p2ppubsub "github.com/libp2p/go-libp2p-pubsub"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+type GaterOpts struct {
+	//if not empty, only the peers in Allow can connect
+	Allow []peer.ID
+	//the peers in Deny can not connect
+	Deny []peer.ID
+	//a peer is banned when it is reported MaxOffenses times within OffensePeriod (default: 5)
+	MaxOffenses int
+	//an offense expires after OffensePeriod (default: 10m)
+	OffensePeriod time.Duration
+	//(default: 1h)
+	BanPeriod time.Duration
+}
+
+func getGaterOpts(opts ...*GaterOpts) *GaterOpts {
+	opt := &GaterOpts{}
+	if len(opts) > 0 && opts[0] != nil {
+		*opt = *opts[0]
+	}
+	if opt.MaxOffenses <= 0 {
+		opt.MaxOffenses = 5
+	}
+	if opt.OffensePeriod <= 0 {
+		opt.OffensePeriod = time.Minute * 10
+	}
+	if opt.BanPeriod <= 0 {
+		opt.BanPeriod = time.Hour
+	}
+	return opt
+}
+
+type Ban struct {
+	Peer   peer.ID
+	Until  time.Time
+	Reason string
+}
+
+//Gater is a connection gater with allow/deny lists and a reputation tracker.
+//The hosts created by a HostGenerator with HostOpts.Gater share the Gater.
+type Gater struct {
+	mutex         sync.Mutex
+	maxOffenses   int
+	offensePeriod time.Duration
+	banPeriod     time.Duration
+	allow         map[peer.ID]struct{}
+	deny          map[peer.ID]struct{}
+	offenses      map[peer.ID][]time.Time
+	bans          map[peer.ID]Ban
+	hosts         map[host.Host]struct{}
+}
+
+func NewGater(opts ...*GaterOpts) *Gater {
+	opt := getGaterOpts(opts...)
+	g := &Gater{
+		maxOffenses:   opt.MaxOffenses,
+		offensePeriod: opt.OffensePeriod,
+		banPeriod:     opt.BanPeriod,
+		allow:         make(map[peer.ID]struct{}),
+		deny:          make(map[peer.ID]struct{}),
+		offenses:      make(map[peer.ID][]time.Time),
+		bans:          make(map[peer.ID]Ban),
+		hosts:         make(map[host.Host]struct{}),
+	}
+	g.Allow(opt.Allow...)
+	g.Deny(opt.Deny...)
+	return g
+}
+
+//HostGater returns the Gater of h, or nil if h has no Gater.
+func HostGater(h host.Host) *Gater {
+	if gh, ok := h.(interface{ Gater() *Gater }); ok {
+		return gh.Gater()
+	}
+	return nil
+}
+
+func (g *Gater) attach(h host.Host) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.hosts[h] = struct{}{}
+}
+func (g *Gater) detach(h host.Host) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.hosts, h)
+}
+
+//Allow adds pids to the allow list.
+func (g *Gater) Allow(pids ...peer.ID) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for _, pid := range pids {
+		g.allow[pid] = struct{}{}
+	}
+}
+
+//Deny adds pids to the deny list and disconnects them.
+func (g *Gater) Deny(pids ...peer.ID) {
+	g.mutex.Lock()
+	for _, pid := range pids {
+		g.deny[pid] = struct{}{}
+	}
+	g.mutex.Unlock()
+	for _, pid := range pids {
+		g.disconnect(pid)
+	}
+}
+
+//Remove removes pid from both the allow and deny lists.
+func (g *Gater) Remove(pid peer.ID) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.allow, pid)
+	delete(g.deny, pid)
+}
+
+//Report records an offense of pid.
+//pid is banned for the BanPeriod and disconnected when its offenses within the OffensePeriod reach MaxOffenses.
+//It returns true if pid is banned by the offense.
+func (g *Gater) Report(pid peer.ID, reason string) bool {
+	g.mutex.Lock()
+	if _, ok := g.bans[pid]; ok {
+		g.mutex.Unlock()
+		return false
+	}
+	g.offenses[pid] = append(g.pruneOffenses(pid), time.Now())
+	if len(g.offenses[pid]) < g.maxOffenses {
+		g.mutex.Unlock()
+		return false
+	}
+	delete(g.offenses, pid)
+	g.bans[pid] = Ban{pid, time.Now().Add(g.banPeriod), reason}
+	g.mutex.Unlock()
+
+	g.disconnect(pid)
+	return true
+}
+
+//Offenses returns the number of the offenses of pid since its last ban, except the expired ones.
+func (g *Gater) Offenses(pid peer.ID) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return len(g.pruneOffenses(pid))
+}
+
+//pruneOffenses removes the expired offenses of pid and returns the rest.
+func (g *Gater) pruneOffenses(pid peer.ID) []time.Time {
+	expiry := time.Now().Add(-g.offensePeriod)
+	offenses := g.offenses[pid]
+	idx := 0
+	for idx < len(offenses) && offenses[idx].Before(expiry) {
+		idx++
+	}
+	if idx == len(offenses) {
+		delete(g.offenses, pid)
+		return nil
+	}
+	g.offenses[pid] = offenses[idx:]
+	return g.offenses[pid]
+}
+
+//Bans returns the current bans sorted by their expiry.
+func (g *Gater) Bans() []Ban {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.pruneBans()
+	bans := make([]Ban, 0, len(g.bans))
+	for _, ban := range g.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Until.Before(bans[j].Until)
+	})
+	return bans
+}
+func (g *Gater) Unban(pid peer.ID) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.bans, pid)
+	delete(g.offenses, pid)
+}
+
+//IsBlocked returns true if pid is denied, not allowed or banned.
+func (g *Gater) IsBlocked(pid peer.ID) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.isBlocked(pid)
+}
+func (g *Gater) isBlocked(pid peer.ID) bool {
+	if _, ok := g.deny[pid]; ok {
+		return true
+	}
+	if _, ok := g.allow[pid]; !ok && len(g.allow) > 0 {
+		return true
+	}
+	g.pruneBans()
+	_, ok := g.bans[pid]
+	return ok
+}
+func (g *Gater) pruneBans() {
+	now := time.Now()
+	for pid, ban := range g.bans {
+		if now.After(ban.Until) {
+			delete(g.bans, pid)
+		}
+	}
+}
+
+//the connections are closed in another goroutine,
+//since Report may be called in the event loop of a pubsub router.
+func (g *Gater) disconnect(pid peer.ID) {
+	g.mutex.Lock()
+	hosts := make([]host.Host, 0, len(g.hosts))
+	for h := range g.hosts {
+		hosts = append(hosts, h)
+	}
+	g.mutex.Unlock()
+
+	go func() {
+		for _, h := range hosts {
+			h.Network().ClosePeer(pid)
+		}
+	}()
+}
+
+func (g *Gater) InterceptPeerDial(pid peer.ID) bool {
+	return !g.IsBlocked(pid)
+}
+func (g *Gater) InterceptAddrDial(pid peer.ID, _ ma.Multiaddr) bool {
+	return !g.IsBlocked(pid)
+}
+func (g *Gater) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+func (g *Gater) InterceptSecured(_ network.Direction, pid peer.ID, _ network.ConnMultiaddrs) bool {
+	return !g.IsBlocked(pid)
+}
+func (g *Gater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+//MessageOffense is set to p2ppubsub.Message.ValidatorData by a validator
+//which rejects a message regardless of its local state, e.g. for malformed data or a bad signature.
+//The author of the rejected message is reported to the Gater of the host.
+type MessageOffense struct {
+	Reason string
+}
+
+//gaterTracer reports the peers which send invalid pubsub messages to the Gater.
+type gaterTracer struct {
+	g    *Gater
+	self peer.ID
+}
+
+func newGaterTracer(g *Gater, self peer.ID) *gaterTracer {
+	return &gaterTracer{g, self}
+}
+
+//a message with a bad signature is an offense of the peer which sent it, since its author is unknown.
+//a message rejected by a validator is an offense of its author only if it is marked by a MessageOffense,
+//since the other rejections may depend on the local state, e.g. the grants which are not synced yet.
+//messages ignored by validators, e.g. duplicated crdt deltas, are not offenses.
+func (gt *gaterTracer) RejectMessage(msg *p2ppubsub.Message, reason string) {
+	pid := msg.ReceivedFrom
+	switch reason {
+	case p2ppubsub.RejectInvalidSignature,
+		p2ppubsub.RejectMissingSignature,
+		p2ppubsub.RejectUnexpectedSignature,
+		p2ppubsub.RejectUnexpectedAuthInfo:
+	case p2ppubsub.RejectValidationFailed:
+		mo, ok := msg.ValidatorData.(MessageOffense)
+		if !ok {
+			return
+		}
+		reason = mo.Reason
+		if from := msg.GetFrom(); from != "" {
+			pid = from
+		}
+	default:
+		return
+	}
+	if pid == "" || pid == gt.self {
+		return
+	}
+	gt.g.Report(pid, "pubsub "+reason+": "+msg.GetTopic())
+}
+func (gt *gaterTracer) AddPeer(peer.ID, protocol.ID)            {}
+func (gt *gaterTracer) RemovePeer(peer.ID)                      {}
+func (gt *gaterTracer) Join(string)                             {}
+func (gt *gaterTracer) Leave(string)                            {}
+func (gt *gaterTracer) Graft(peer.ID, string)                   {}
+func (gt *gaterTracer) Prune(peer.ID, string)                   {}
+func (gt *gaterTracer) ValidateMessage(*p2ppubsub.Message)      {}
+func (gt *gaterTracer) DeliverMessage(*p2ppubsub.Message)       {}
+func (gt *gaterTracer) DuplicateMessage(*p2ppubsub.Message)     {}
+func (gt *gaterTracer) ThrottlePeer(peer.ID)                    {}
+func (gt *gaterTracer) RecvRPC(*p2ppubsub.RPC)                  {}
+func (gt *gaterTracer) SendRPC(*p2ppubsub.RPC, peer.ID)         {}
+func (gt *gaterTracer) DropRPC(*p2ppubsub.RPC, peer.ID)         {}
+func (gt *gaterTracer) UndeliverableMessage(*p2ppubsub.Message) {}
@@ -0,0 +1,291 @@
+package p2pverse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	pnet "github.com/libp2p/go-libp2p-core/pnet"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	kad "github.com/libp2p/go-libp2p-kad-dht"
+	rcmgr "github.com/libp2p/go-libp2p-resource-manager"
+	connmgr "github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+	tcp "github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	websocket "github.com/libp2p/go-libp2p/p2p/transport/websocket"
+)
+
+type Transport string
+
+const (
+	TCP       Transport = "tcp"
+	QUIC      Transport = "quic"
+	WebSocket Transport = "ws"
+)
+
+type KeyType int
+
+const (
+	Ed25519 KeyType = iota
+	//2048 bits
+	RSA
+	Secp256k1
+	ECDSA
+)
+
+func (kt KeyType) p2pKeyType() int {
+	switch kt {
+	case RSA:
+		return p2pcrypto.RSA
+	case Secp256k1:
+		return p2pcrypto.Secp256k1
+	case ECDSA:
+		return p2pcrypto.ECDSA
+	default:
+		return p2pcrypto.Ed25519
+	}
+}
+
+type Reachability int
+
+const (
+	//the reachability is detected by AutoNAT
+	ReachabilityAuto Reachability = iota
+	ReachabilityPublic
+	ReachabilityPrivate
+)
+
+type HostOpts struct {
+	//the type of the identity key (default: Ed25519)
+	KeyType KeyType
+	//listen multiaddrs, e.g. "/ip4/0.0.0.0/tcp/4001" (default: any port of all interfaces for each transport)
+	ListenAddrs []string
+	//default: TCP, QUIC and WebSocket
+	Transports []Transport
+	//the connection manager trims the connections to ConnLow when more than ConnHigh are open.
+	//It is disabled if ConnHigh is 0.
+	ConnLow  int
+	ConnHigh int
+	//new connections are not trimmed during ConnGrace (default: 1m)
+	ConnGrace time.Duration
+	//the resource manager limits of the whole host. 0 means the default limit of libp2p.
+	MaxConns   int
+	MaxStreams int
+	MaxFD      int
+	//overrides the default limiter of the resource manager
+	Limiter      rcmgr.Limiter
+	Reachability Reachability
+	NATPortMap   bool
+	HolePunching bool
+	DisableRelay bool
+	//the host relays the connections of other peers as a circuit relay v2 service
+	RelayService bool
+	//the pre-shared key of a private network. Only the hosts with the same PSK can connect to each other.
+	//QUIC does not support private networks, so it is removed from the default Transports.
+	PSK pnet.PSK
+	//the protocol prefix of all the DHTs created for the host, e.g. "/my-network" (default: "/ipfs").
+	//If PSK is set, the default is "/p2p-verse".
+	DHTPrefix string
+	//the connection gater of the host, which can be shared by the hosts of the HostGenerator
+	Gater *Gater
+}
+
+const privateDHTPrefix = "/p2p-verse"
+
+//NewPSK generates a pre-shared key of a private network.
+//A PSK stored in the swarm.key format can be read by pnet.DecodeV1PSK.
+func NewPSK(seeds ...io.Reader) (pnet.PSK, error) {
+	psk := make([]byte, 32)
+	if _, err := io.ReadFull(getSeed(seeds...), psk); err != nil {
+		return nil, err
+	}
+	return psk, nil
+}
+
+func getHostOpts(opts ...*HostOpts) *HostOpts {
+	opt := &HostOpts{}
+	if len(opts) > 0 && opts[0] != nil {
+		*opt = *opts[0]
+	}
+	if len(opt.Transports) == 0 {
+		opt.Transports = []Transport{TCP, QUIC, WebSocket}
+		if len(opt.PSK) > 0 {
+			opt.Transports = []Transport{TCP, WebSocket}
+		}
+	}
+	if opt.DHTPrefix == "" && len(opt.PSK) > 0 {
+		opt.DHTPrefix = privateDHTPrefix
+	}
+	if len(opt.ListenAddrs) == 0 {
+		opt.ListenAddrs = defaultListenAddrs(opt.Transports)
+	}
+	if opt.ConnGrace <= 0 {
+		opt.ConnGrace = time.Minute
+	}
+	return opt
+}
+func defaultListenAddrs(tpts []Transport) []string {
+	addrs := make([]string, 0)
+	for _, tpt := range tpts {
+		switch tpt {
+		case TCP:
+			addrs = append(addrs, "/ip4/0.0.0.0/tcp/0", "/ip6/::/tcp/0")
+		case QUIC:
+			addrs = append(addrs, "/ip4/0.0.0.0/udp/0/quic", "/ip6/::/udp/0/quic")
+		case WebSocket:
+			addrs = append(addrs, "/ip4/0.0.0.0/tcp/0/ws", "/ip6/::/tcp/0/ws")
+		}
+	}
+	return addrs
+}
+
+//NewHostGenerator returns a HostGenerator which creates hosts configured by opts.
+//The identity key is generated from the seed given to the HostGenerator.
+func NewHostGenerator(opts ...*HostOpts) HostGenerator {
+	opt := getHostOpts(opts...)
+	return func(seeds ...io.Reader) (host.Host, error) {
+		lOpts, err := opt.libp2pOptions(getSeed(seeds...))
+		if err != nil {
+			return nil, err
+		}
+		h, err := libp2p.New(lOpts...)
+		if err != nil {
+			return nil, err
+		}
+		if opt.DHTPrefix == "" && opt.Gater == nil {
+			return h, nil
+		}
+		if opt.Gater != nil {
+			opt.Gater.attach(h)
+		}
+		return &verseHost{h, protocol.ID(opt.DHTPrefix), opt.Gater}, nil
+	}
+}
+
+//verseHost tells the DHTs and the pubsub routers created for it to use its protocol prefix and Gater.
+type verseHost struct {
+	host.Host
+	prefix protocol.ID
+	gater  *Gater
+}
+
+func (h *verseHost) DHTProtocolPrefix() protocol.ID {
+	return h.prefix
+}
+func (h *verseHost) Gater() *Gater {
+	return h.gater
+}
+func (h *verseHost) Close() error {
+	if h.gater != nil {
+		h.gater.detach(h.Host)
+	}
+	return h.Host.Close()
+}
+
+//every DHT of the library is created by newKad so that the protocol prefix of h is used.
+func newKad(ctx context.Context, h host.Host, opts ...kad.Option) (*kad.IpfsDHT, error) {
+	if ph, ok := h.(interface{ DHTProtocolPrefix() protocol.ID }); ok && ph.DHTProtocolPrefix() != "" {
+		opts = append(opts, kad.ProtocolPrefix(ph.DHTProtocolPrefix()))
+	}
+	return kad.New(ctx, h, opts...)
+}
+
+func (opt *HostOpts) libp2pOptions(seed io.Reader) ([]libp2p.Option, error) {
+	priv, _, err := p2pcrypto.GenerateKeyPairWithReader(opt.KeyType.p2pKeyType(), 2048, seed)
+	if err != nil {
+		return nil, err
+	}
+	lOpts := []libp2p.Option{
+		libp2p.Identity(priv),
+		libp2p.DefaultSecurity,
+		libp2p.ListenAddrStrings(opt.ListenAddrs...),
+	}
+	if len(opt.PSK) > 0 {
+		lOpts = append(lOpts, libp2p.PrivateNetwork(opt.PSK))
+	}
+	if opt.Gater != nil {
+		lOpts = append(lOpts, libp2p.ConnectionGater(opt.Gater))
+	}
+
+	for _, tpt := range opt.Transports {
+		switch tpt {
+		case TCP:
+			lOpts = append(lOpts, libp2p.Transport(tcp.NewTCPTransport))
+		case QUIC:
+			if len(opt.PSK) > 0 {
+				return nil, errors.New("QUIC does not support private networks")
+			}
+			lOpts = append(lOpts, libp2p.Transport(quic.NewTransport))
+		case WebSocket:
+			lOpts = append(lOpts, libp2p.Transport(websocket.New))
+		default:
+			return nil, errors.New("unknown transport: " + string(tpt))
+		}
+	}
+
+	if opt.ConnHigh > 0 {
+		cm, err := connmgr.NewConnManager(opt.ConnLow, opt.ConnHigh, connmgr.WithGracePeriod(opt.ConnGrace))
+		if err != nil {
+			return nil, err
+		}
+		lOpts = append(lOpts, libp2p.ConnectionManager(cm))
+	}
+
+	if limiter := opt.limiter(); limiter != nil {
+		rm, err := rcmgr.NewResourceManager(limiter)
+		if err != nil {
+			return nil, err
+		}
+		lOpts = append(lOpts, libp2p.ResourceManager(rm))
+	}
+
+	switch opt.Reachability {
+	case ReachabilityPublic:
+		lOpts = append(lOpts, libp2p.ForceReachabilityPublic())
+	case ReachabilityPrivate:
+		lOpts = append(lOpts, libp2p.ForceReachabilityPrivate())
+	}
+	if opt.NATPortMap {
+		lOpts = append(lOpts, libp2p.NATPortMap())
+	}
+	if opt.HolePunching {
+		lOpts = append(lOpts, libp2p.EnableHolePunching())
+	}
+	if opt.DisableRelay {
+		lOpts = append(lOpts, libp2p.DisableRelay())
+	} else {
+		lOpts = append(lOpts, libp2p.EnableRelay())
+	}
+	if opt.RelayService {
+		lOpts = append(lOpts, libp2p.EnableRelayService())
+	}
+	return lOpts, nil
+}
+
+//nil means the default resource manager of libp2p.
+func (opt *HostOpts) limiter() rcmgr.Limiter {
+	if opt.Limiter != nil {
+		return opt.Limiter
+	}
+	if opt.MaxConns <= 0 && opt.MaxStreams <= 0 && opt.MaxFD <= 0 {
+		return nil
+	}
+
+	limiter := rcmgr.NewDefaultLimiter()
+	sys := limiter.SystemLimits
+	if opt.MaxConns > 0 {
+		sys = sys.WithConnLimit(opt.MaxConns, opt.MaxConns, opt.MaxConns)
+	}
+	if opt.MaxStreams > 0 {
+		sys = sys.WithStreamLimit(opt.MaxStreams, opt.MaxStreams, opt.MaxStreams)
+	}
+	if opt.MaxFD > 0 {
+		sys = sys.WithFDLimit(opt.MaxFD)
+	}
+	limiter.SystemLimits = sys
+	return limiter
+}
@@ -8,14 +8,16 @@ import (
 
 	ipfslt "github.com/hsanjuan/ipfs-lite"
 	host "github.com/libp2p/go-libp2p-core/host"
+	multierr "go.uber.org/multierr"
 
 	pv "github.com/pilinsin/p2p-verse"
 )
 
 type cidGetter struct {
-	h    host.Host
-	dht  *pv.DiscoveryDHT
-	ipfs *ipfslt.Peer
+	cancel func()
+	h      host.Host
+	dht    *pv.DiscoveryDHT
+	ipfs   *ipfslt.Peer
 }
 
 func NewCidGetter() (*cidGetter, error) {
@@ -25,21 +27,28 @@ func NewCidGetter() (*cidGetter, error) {
 	}
 	dht, err := pv.NewDHT(h)
 	if err != nil {
+		h.Close()
 		return nil, err
 	}
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
 	store := ipfslt.NewInMemoryDatastore()
 	ipfs, err := ipfslt.New(ctx, store, h, dht.DHT(), nil)
 	if err != nil {
+		cancel()
+		dht.Close()
+		h.Close()
 		return nil, err
 	}
 
-	return &cidGetter{h, dht, ipfs}, nil
+	return &cidGetter{cancel, h, dht, ipfs}, nil
 }
-func (cg *cidGetter) Close() {
-	cg.dht.Close()
-	cg.h.Close()
+
+//the ipfs-lite peer is stopped before the DHT and the host are closed.
+func (cg *cidGetter) Close() error {
+	cg.cancel()
+	err := cg.dht.Close()
+	return multierr.Append(err, cg.h.Close())
 }
 
 func (cg *cidGetter) addReader(ctx context.Context, ap *ipfslt.AddParams, r io.Reader) (string, error) {
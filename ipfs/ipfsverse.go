@@ -5,7 +5,7 @@ import (
 	"context"
 	"errors"
 	"io"
-	"os"
+	"sync"
 	"time"
 
 	pv "github.com/pilinsin/p2p-verse"
@@ -14,10 +14,7 @@ import (
 
 	ipfslt "github.com/hsanjuan/ipfs-lite"
 	cid "github.com/ipfs/go-cid"
-	ds "github.com/ipfs/go-datastore"
-	badger "github.com/ipfs/go-ds-badger2"
 	uio "github.com/ipfs/go-unixfs/io"
-	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
@@ -50,7 +47,7 @@ func splitToBlocks(r io.Reader) ([]io.Reader, error) {
 		}
 	}
 }
-func mergeFromBlocks(rs []uio.ReadSeekCloser) (io.Reader, error) {
+func mergeFromBlocks(rs []uio.ReadSeekCloser) (*bytes.Reader, error) {
 	buf := &bytes.Buffer{}
 	for _, r := range rs {
 		if _, err := r.WriteTo(buf); err != nil {
@@ -80,74 +77,98 @@ func (bc *blockCids) Unmarshal(m []byte) error {
 }
 
 type Ipfs interface {
-	Close()
+	Close() error
 	AddrInfo() peer.AddrInfo
 	AddReader(io.Reader, ...time.Duration) (string, error)
+	AddReaderContext(context.Context, io.Reader) (string, error)
 	Add([]byte, ...time.Duration) (string, error)
+	AddContext(context.Context, []byte) (string, error)
 	GetReader(string, ...time.Duration) (io.Reader, error)
+	GetReaderContext(context.Context, string) (io.Reader, error)
 	Get(string, ...time.Duration) ([]byte, error)
+	GetContext(context.Context, string) ([]byte, error)
 	Has(string, ...time.Duration) (bool, error)
+	HasContext(context.Context, string) (bool, error)
 }
 
 type ipfsStore struct {
-	ctx      context.Context
-	cancel   func()
-	dsCancel func()
-	h        host.Host
-	dht      *pv.DiscoveryDHT
-	dStore   ds.Datastore
-	ipfs     *ipfslt.Peer
+	ctx     context.Context
+	cancel  func()
+	node    *pv.Node
+	ownNode bool
+	ipfs    *ipfslt.Peer
+	wMutex  sync.Mutex
+	wg      sync.WaitGroup
 }
 
+//the blocks are stored in a badger datastore at dirPath.
 func NewIpfsStore(hGen pv.HostGenerator, dirPath string, save bool, bootstraps ...peer.AddrInfo) (Ipfs, error) {
-	h, err := hGen()
+	node, err := pv.NewNode(hGen, dirPath, save, bootstraps...)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := os.MkdirAll(dirPath, 0700); err != nil {
-		return nil, err
-	}
-	dsCancel := func() {}
-	if !save {
-		dsCancel = func() { os.RemoveAll(dirPath) }
-	}
-
-	stOpts := badger.DefaultOptions
-	stOpts.InMemory = false
-	store, err := badger.NewDatastore(dirPath, &stOpts)
+	s, err := newIpfsStore(node, true)
 	if err != nil {
+		node.Close()
 		return nil, err
 	}
+	return s, nil
+}
 
-	dht, err := pv.NewDHT(h)
-	if err != nil {
+//the blocks are stored in the datastore of node.
+func NewIpfsStoreFromNode(node *pv.Node) (Ipfs, error) {
+	return newIpfsStore(node, false)
+}
+func newIpfsStore(node *pv.Node, ownNode bool) (*ipfsStore, error) {
+	if err := node.DHT().Bootstrap("ipfs-keyword", node.Bootstraps()); err != nil {
 		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	ipfs, err := ipfslt.New(ctx, store, h, dht.DHT(), nil)
-	if err != nil {
-		cancel()
-		return nil, err
+	return &ipfsStore{ctx: ctx, cancel: cancel, node: node, ownNode: ownNode, ipfs: node.IPFS()}, nil
+}
+
+//the running Add, Get and Has are canceled and waited for before the node is closed.
+//the discovery of "ipfs-keyword" is stopped even if the node is shared.
+func (s *ipfsStore) Close() error {
+	s.wMutex.Lock()
+	s.cancel()
+	s.wMutex.Unlock()
+	s.wg.Wait()
+
+	if s.ownNode {
+		return s.node.Close()
 	}
-	if err := dht.Bootstrap("ipfs-keyword", bootstraps); err != nil {
-		cancel()
-		return nil, err
+	s.node.DHT().StopDiscovery("ipfs-keyword")
+	return nil
+}
+
+//run runs f with ctx, which is also canceled by Close, and Close waits for f.
+func (s *ipfsStore) run(ctx context.Context, f func(context.Context) error) error {
+	s.wMutex.Lock()
+	if s.ctx.Err() != nil {
+		s.wMutex.Unlock()
+		return errors.New("ipfs store is closed")
 	}
+	s.wg.Add(1)
+	s.wMutex.Unlock()
+	defer s.wg.Done()
 
-	return &ipfsStore{ctx, cancel, dsCancel, h, dht, store, ipfs}, nil
-}
-func (s *ipfsStore) Close() {
-	s.cancel()
-	s.dStore.Close()
-	s.dsCancel()
-	s.dht.Close()
-	s.h.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return f(ctx)
 }
 
 func (s *ipfsStore) AddrInfo() peer.AddrInfo {
-	return pv.HostToAddrInfo(s.h)
+	return s.node.AddrInfo()
 }
 func (s *ipfsStore) addReader(ctx context.Context, ap *ipfslt.AddParams, r io.Reader) (string, error) {
 	nd, err := s.ipfs.AddFile(ctx, r, ap)
@@ -169,8 +190,20 @@ func (s *ipfsStore) newBlockCids(ctx context.Context, ap *ipfslt.AddParams, rs [
 }
 func (s *ipfsStore) AddReader(r io.Reader, timeouts ...time.Duration) (string, error) {
 	timeout := getDurationFromDurations(timeouts)
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
 	defer cancel()
+	return s.AddReaderContext(ctx, r)
+}
+func (s *ipfsStore) AddReaderContext(ctx context.Context, r io.Reader) (string, error) {
+	var cidStr string
+	err := s.run(ctx, func(ctx context.Context) error {
+		var err error
+		cidStr, err = s.addReaderContext(ctx, r)
+		return err
+	})
+	return cidStr, err
+}
+func (s *ipfsStore) addReaderContext(ctx context.Context, r io.Reader) (string, error) {
 	ap := &ipfslt.AddParams{
 		Shard:   true,
 		HashFun: "sha3-256",
@@ -180,6 +213,10 @@ func (s *ipfsStore) AddReader(r io.Reader, timeouts ...time.Duration) (string, e
 	if err != nil {
 		return "", err
 	}
+	size := 0
+	for _, r := range rs {
+		size += r.(*bytes.Buffer).Len()
+	}
 	bc, err := s.newBlockCids(ctx, ap, rs)
 	if err != nil {
 		return "", err
@@ -188,12 +225,24 @@ func (s *ipfsStore) AddReader(r io.Reader, timeouts ...time.Duration) (string, e
 	if err != nil {
 		return "", err
 	}
-	return s.addReader(ctx, ap, bytes.NewBuffer(m))
+	cidStr, err := s.addReader(ctx, ap, bytes.NewBuffer(m))
+	if err != nil {
+		return "", err
+	}
+
+	metrics := pv.DefaultMetrics()
+	metrics.Add("p2pverse_ipfs_blocks_added_total", float64(len(rs)))
+	metrics.Add("p2pverse_ipfs_bytes_added_total", float64(size))
+	return cidStr, nil
 }
 func (s *ipfsStore) Add(data []byte, timeouts ...time.Duration) (string, error) {
 	buf := bytes.NewBuffer(data)
 	return s.AddReader(buf, timeouts...)
 }
+func (s *ipfsStore) AddContext(ctx context.Context, data []byte) (string, error) {
+	buf := bytes.NewBuffer(data)
+	return s.AddReaderContext(ctx, buf)
+}
 
 func (s *ipfsStore) getReader(ctx context.Context, cidStr string) (uio.ReadSeekCloser, error) {
 	c, err := cid.Decode(cidStr)
@@ -215,9 +264,20 @@ func (s *ipfsStore) getReadersFromBlockCids(ctx context.Context, bc *blockCids)
 }
 func (s *ipfsStore) GetReader(cidStr string, timeouts ...time.Duration) (io.Reader, error) {
 	timeout := getDurationFromDurations(timeouts)
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
 	defer cancel()
-
+	return s.GetReaderContext(ctx, cidStr)
+}
+func (s *ipfsStore) GetReaderContext(ctx context.Context, cidStr string) (io.Reader, error) {
+	var r io.Reader
+	err := s.run(ctx, func(ctx context.Context) error {
+		var err error
+		r, err = s.getReaderContext(ctx, cidStr)
+		return err
+	})
+	return r, err
+}
+func (s *ipfsStore) getReaderContext(ctx context.Context, cidStr string) (io.Reader, error) {
 	bcr, err := s.getReader(ctx, cidStr)
 	if err != nil {
 		return nil, err
@@ -234,7 +294,15 @@ func (s *ipfsStore) GetReader(cidStr string, timeouts ...time.Duration) (io.Read
 	if err != nil {
 		return nil, err
 	}
-	return mergeFromBlocks(rs)
+	r, err := mergeFromBlocks(rs)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := pv.DefaultMetrics()
+	metrics.Add("p2pverse_ipfs_blocks_fetched_total", float64(len(rs)))
+	metrics.Add("p2pverse_ipfs_bytes_fetched_total", float64(r.Len()))
+	return r, nil
 }
 func (s *ipfsStore) Get(cidStr string, timeouts ...time.Duration) ([]byte, error) {
 	r, err := s.GetReader(cidStr, timeouts...)
@@ -244,16 +312,32 @@ func (s *ipfsStore) Get(cidStr string, timeouts ...time.Duration) ([]byte, error
 
 	return io.ReadAll(r)
 }
+func (s *ipfsStore) GetContext(ctx context.Context, cidStr string) ([]byte, error) {
+	r, err := s.GetReaderContext(ctx, cidStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
 func (s *ipfsStore) Has(cidStr string, timeouts ...time.Duration) (bool, error) {
+	timeout := getDurationFromDurations(timeouts)
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	return s.HasContext(ctx, cidStr)
+}
+func (s *ipfsStore) HasContext(ctx context.Context, cidStr string) (bool, error) {
 	c, err := cid.Decode(cidStr)
 	if err != nil {
 		return false, err
 	}
 
-	timeout := getDurationFromDurations(timeouts)
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	has, err := s.ipfs.HasBlock(ctx, c)
+	var has bool
+	err = s.run(ctx, func(ctx context.Context) error {
+		var err error
+		has, err = s.ipfs.HasBlock(ctx, c)
+		return err
+	})
 	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
 		return false, err
 	}
@@ -2,7 +2,9 @@ package ipfsverse
 
 import (
 	"bytes"
+	"context"
 	"testing"
+	"time"
 
 	pv "github.com/pilinsin/p2p-verse"
 )
@@ -66,5 +68,40 @@ func BaseTestIpfs(t *testing.T, hGen pv.HostGenerator) {
 	checkError(t, err)
 	assertError(t, c == c2, "different cid for the same []byte")
 
+	c3, err := cg.Get([]byte("nobody has this"))
+	checkError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = ipfs2.GetContext(ctx, c3)
+	assertError(t, err != nil, "GetContext must fail after the deadline")
+
+	//Close cancels and waits for the running Get, and keeps a shared node
+	node, err := pv.NewNode(hGen, "ipfs3", false, bAddrInfo)
+	checkError(t, err)
+	defer node.Close()
+	ipfs3, err := NewIpfsStoreFromNode(node)
+	checkError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		_, err := ipfs3.Get(c3, time.Minute)
+		done <- err
+	}()
+	time.Sleep(time.Second)
+	checkError(t, ipfs3.Close())
+	select {
+	case err := <-done:
+		assertError(t, err != nil, "the running Get must be canceled")
+	default:
+		t.Fatal("Close must wait for the running Get")
+	}
+	_, err = ipfs3.Get(c)
+	assertError(t, err != nil, "Get must fail after Close")
+	ipfs4, err := NewIpfsStoreFromNode(node)
+	checkError(t, err)
+	defer ipfs4.Close()
+	v, err = ipfs4.Get(c)
+	checkError(t, err)
+	assertError(t, bytes.Equal(v, []byte("meow meow ^.^")), "the shared node must be kept")
+
 	t.Log("finished")
 }
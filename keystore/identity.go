@@ -0,0 +1,112 @@
+package keystore
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	bip39 "github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+
+	pv "github.com/pilinsin/p2p-verse"
+)
+
+const (
+	mnemonicEntropy = 256
+	seedSize        = 64
+	hostLabel       = "host"
+	labelPrefix     = "p2p-verse/"
+)
+
+//NewMnemonic generates a 24 words BIP39 mnemonic.
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropy)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+//Identity derives the host key and any number of labeled key pairs from one secret.
+//The same secret always derives the same keys, so the peer ID and the signature store pids are recovered from it.
+type Identity struct {
+	seed []byte
+}
+
+//IdentityFromMnemonic derives an Identity from a BIP39 mnemonic and an optional passphrase.
+//The checksum of mnemonic is verified, so a mistyped word is detected.
+func IdentityFromMnemonic(mnemonic, passphrase string) (*Identity, error) {
+	mnemonic = strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic: %w", err)
+	}
+	return &Identity{seed}, nil
+}
+
+//IdentityFromPassphrase derives an Identity from passphrase and salt by argon2id.
+//salt should be unique to the user, e.g. a user name, because the same pair derives the same keys.
+func IdentityFromPassphrase(passphrase, salt []byte) (*Identity, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("no passphrase is given")
+	}
+	if len(salt) == 0 {
+		return nil, errors.New("no salt is given")
+	}
+	seed := argon2.IDKey(passphrase, salt, argonTime, argonMemory, argonThreads, seedSize)
+	return &Identity{seed}, nil
+}
+
+//Seed returns the deterministic byte stream of label.
+//It is usable as the seed of a HostGenerator or other generators.
+//The label "host" is reserved for HostKey.
+func (id *Identity) Seed(label string) io.Reader {
+	if label == hostLabel {
+		return errReader{errors.New("the label is reserved for the host key")}
+	}
+	return id.seedOf(label)
+}
+func (id *Identity) seedOf(label string) io.Reader {
+	return hkdf.New(sha256.New, id.seed, nil, []byte(labelPrefix+label))
+}
+
+//KeyPair derives the Ed25519 key pair of label, e.g. the name of a signature store.
+//The keys are usable as crdt StoreOpts.Priv and StoreOpts.Pub.
+//The label "host" is reserved for HostKey, so that a store key never shares the identity of the host.
+func (id *Identity) KeyPair(label string) (p2pcrypto.PrivKey, p2pcrypto.PubKey, error) {
+	if label == "" {
+		return nil, nil, errors.New("no label is given")
+	}
+	if label == hostLabel {
+		return nil, nil, errors.New("the label is reserved for the host key")
+	}
+	return p2pcrypto.GenerateEd25519Key(id.seedOf(label))
+}
+
+//HostKey derives the key pair of the host under the reserved label "host".
+func (id *Identity) HostKey() (p2pcrypto.PrivKey, p2pcrypto.PubKey, error) {
+	return p2pcrypto.GenerateEd25519Key(id.seedOf(hostLabel))
+}
+
+//NewHost creates a host whose identity is HostKey.
+func (id *Identity) NewHost(hGen pv.HostGenerator) (host.Host, error) {
+	priv, _, err := id.HostKey()
+	if err != nil {
+		return nil, err
+	}
+	return pv.HostFromKey(hGen, priv)
+}
+
+//errReader fails every Read, so that a generator seeded by a reserved label fails.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,82 @@
+package keystore
+
+import (
+	"strings"
+	"testing"
+
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	pv "github.com/pilinsin/p2p-verse"
+)
+
+func TestIdentity(t *testing.T) {
+	mnemonic, err := NewMnemonic()
+	checkError(t, err)
+	assertError(t, len(strings.Fields(mnemonic)) == 24, "invalid mnemonic:", mnemonic)
+
+	id, err := IdentityFromMnemonic(mnemonic, "pass")
+	checkError(t, err)
+	h, err := id.NewHost(pv.SampleHost)
+	checkError(t, err)
+	pid := h.ID()
+	h.Close()
+	_, pub, err := id.KeyPair("signatureStore")
+	checkError(t, err)
+	stPid, err := peer.IDFromPublicKey(pub)
+	checkError(t, err)
+
+	//restore on a new machine
+	id2, err := IdentityFromMnemonic("  "+strings.ToUpper(mnemonic)+"\n", "pass")
+	checkError(t, err)
+	h2, err := id2.NewHost(pv.SampleHost)
+	checkError(t, err)
+	assertError(t, h2.ID() == pid, "the peer ID must be recovered")
+	h2.Close()
+	_, pub2, err := id2.KeyPair("signatureStore")
+	checkError(t, err)
+	stPid2, err := peer.IDFromPublicKey(pub2)
+	checkError(t, err)
+	assertError(t, stPid == stPid2, "the store pid must be recovered")
+
+	_, pub3, err := id2.KeyPair("otherStore")
+	checkError(t, err)
+	assertError(t, !pub.Equals(pub3), "the labels must derive different keys")
+	id3, err := IdentityFromMnemonic(mnemonic, "other")
+	checkError(t, err)
+	_, pub4, err := id3.KeyPair("signatureStore")
+	checkError(t, err)
+	assertError(t, !pub.Equals(pub4), "the passphrase must derive different keys")
+
+	words := strings.Fields(mnemonic)
+	words[0], words[1] = words[1], words[0]
+	if words[0] != words[1] {
+		_, err = IdentityFromMnemonic(strings.Join(words, " "), "pass")
+		assertError(t, err != nil, "a wrong mnemonic must be rejected")
+	}
+
+	//the derivation must not change between versions
+	id4, err := IdentityFromMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	checkError(t, err)
+	hPriv, _, err := id4.HostKey()
+	checkError(t, err)
+	hPid, err := peer.IDFromPrivateKey(hPriv)
+	checkError(t, err)
+	assertError(t, hPid.String() == "12D3KooWSjuQvkzWhNrprYCe3z163pNeVd82fiWBxJqqkewFVnuE", "the derivation is changed:", hPid)
+	_, _, err = id4.KeyPair("host")
+	assertError(t, err != nil, "the label of the host key must be reserved")
+	_, _, err = p2pcrypto.GenerateEd25519Key(id4.Seed("host"))
+	assertError(t, err != nil, "the seed of the host key must be reserved")
+
+	pId, err := IdentityFromPassphrase([]byte("passphrase"), []byte("user name"))
+	checkError(t, err)
+	pId2, err := IdentityFromPassphrase([]byte("passphrase"), []byte("user name"))
+	checkError(t, err)
+	priv5, _, err := pId.KeyPair("signatureStore")
+	checkError(t, err)
+	priv6, _, err := pId2.KeyPair("signatureStore")
+	checkError(t, err)
+	assertError(t, priv5.Equals(priv6), "the passphrase and salt must derive the same key")
+	_, err = IdentityFromPassphrase([]byte("passphrase"), nil)
+	assertError(t, err != nil, "no salt must be rejected")
+}
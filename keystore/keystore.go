@@ -0,0 +1,334 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	"golang.org/x/crypto/argon2"
+
+	pv "github.com/pilinsin/p2p-verse"
+)
+
+const (
+	keyExt        = ".key"
+	keyVersion    = 1
+	saltSize      = 16
+	argonTime     = 1
+	argonMemory   = 64 * 1024
+	argonThreads  = 4
+	encryptionKey = 32
+
+	//the argon2 parameters of a key file are limited,
+	//so that a crafted key file cannot exhaust the memory or the CPU before the passphrase is checked.
+	maxArgonTime    = 16
+	maxArgonMemory  = 256 * 1024
+	maxArgonThreads = 16
+)
+
+var (
+	ErrKeyNotFound     = errors.New("key not found")
+	ErrKeyExists       = errors.New("key already exists")
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted key")
+	nameRegexp         = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+//encryptedKey is the content of a key file and of an exported key.
+//The private key is marshaled by p2pcrypto.MarshalPrivateKey and encrypted with AES-GCM,
+//whose key is derived from the passphrase by argon2id.
+type encryptedKey struct {
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Nonce   []byte `json:"nonce"`
+	Cipher  []byte `json:"cipher"`
+}
+
+func newAEAD(passphrase, salt []byte, t, m uint32, th uint8) (cipher.AEAD, error) {
+	key := argon2.IDKey(passphrase, salt, t, m, th, encryptionKey)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptKey(priv p2pcrypto.PrivKey, passphrase []byte) ([]byte, error) {
+	m, err := p2pcrypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, salt, argonTime, argonMemory, argonThreads)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ek := &encryptedKey{
+		Version: keyVersion,
+		Type:    priv.Type().String(),
+		Salt:    salt,
+		Time:    argonTime,
+		Memory:  argonMemory,
+		Threads: argonThreads,
+		Nonce:   nonce,
+		Cipher:  aead.Seal(nil, nonce, m, []byte(priv.Type().String())),
+	}
+	return json.Marshal(ek)
+}
+
+func decryptKey(m, passphrase []byte) (p2pcrypto.PrivKey, error) {
+	ek := &encryptedKey{}
+	if err := json.Unmarshal(m, ek); err != nil {
+		return nil, fmt.Errorf("invalid key format: %w", err)
+	}
+	if ek.Version != keyVersion {
+		return nil, fmt.Errorf("unsupported key version %d", ek.Version)
+	}
+	if ek.Time == 0 || ek.Memory == 0 || ek.Threads == 0 {
+		return nil, errors.New("invalid key format: no argon2 parameters")
+	}
+	if ek.Time > maxArgonTime || ek.Memory > maxArgonMemory || ek.Threads > maxArgonThreads {
+		return nil, errors.New("invalid key format: too large argon2 parameters")
+	}
+	aead, err := newAEAD(passphrase, ek.Salt, ek.Time, ek.Memory, ek.Threads)
+	if err != nil {
+		return nil, err
+	}
+	if len(ek.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid key format: invalid nonce")
+	}
+	mpriv, err := aead.Open(nil, ek.Nonce, ek.Cipher, []byte(ek.Type))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return p2pcrypto.UnmarshalPrivateKey(mpriv)
+}
+
+//Keystore saves named private keys to a directory, one encrypted file per key.
+//The keys are libp2p keys, which are also usable as crdt IPrivKey and IPubKey.
+type Keystore struct {
+	mutex      sync.Mutex
+	dir        string
+	passphrase []byte
+}
+
+//Open opens the keystore in dir, which is created if it does not exist.
+//An error is returned if passphrase cannot decrypt the keys already in dir.
+func Open(dir string, passphrase []byte) (*Keystore, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("no passphrase is given")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	ks := &Keystore{dir: dir, passphrase: append([]byte{}, passphrase...)}
+
+	names, err := ks.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		if _, err := ks.Get(names[0]); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+func checkName(name string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid key name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+func (ks *Keystore) path(name string) string {
+	return filepath.Join(ks.dir, name+keyExt)
+}
+
+//List returns the names of the keys in alphabetical order.
+func (ks *Keystore) List() ([]string, error) {
+	fis, err := ioutil.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), keyExt) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(fi.Name(), keyExt))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (ks *Keystore) Has(name string) (bool, error) {
+	if err := checkName(name); err != nil {
+		return false, err
+	}
+	_, err := os.Stat(ks.path(name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//Put saves priv as name.
+//ErrKeyExists is returned if name is already used, so that an identity is not overwritten by mistake.
+func (ks *Keystore) Put(name string, priv p2pcrypto.PrivKey) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if priv == nil {
+		return errors.New("no key is given")
+	}
+	m, err := encryptKey(priv, ks.passphrase)
+	if err != nil {
+		return err
+	}
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	return writeNewFile(ks.path(name), m)
+}
+
+//writeNewFile writes m to a temporary file and links it to path,
+//so that a crash never leaves a partially written key.
+func writeNewFile(path string, m []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return ErrKeyExists
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(m); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Link(f.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return ErrKeyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (ks *Keystore) Get(name string) (p2pcrypto.PrivKey, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	m, err := ioutil.ReadFile(ks.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	priv, err := decryptKey(m, ks.passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", name, err)
+	}
+	return priv, nil
+}
+
+//LoadOrGenerate returns the key of name.
+//If name does not exist, a new Ed25519 key is generated and saved.
+func (ks *Keystore) LoadOrGenerate(name string) (p2pcrypto.PrivKey, error) {
+	priv, err := ks.Get(name)
+	if err != ErrKeyNotFound {
+		return priv, err
+	}
+
+	priv, _, err = p2pcrypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.Put(name, priv); err == ErrKeyExists {
+		//saved by another goroutine at the same time
+		return ks.Get(name)
+	} else if err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
+
+func (ks *Keystore) Delete(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	err := os.Remove(ks.path(name))
+	if os.IsNotExist(err) {
+		return ErrKeyNotFound
+	}
+	return err
+}
+
+//Export returns the key of name encrypted with passphrase, which may differ from the passphrase of the keystore.
+func (ks *Keystore) Export(name string, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("no passphrase is given")
+	}
+	priv, err := ks.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return encryptKey(priv, passphrase)
+}
+
+//Import saves the key exported by Export as name.
+//passphrase is the one given to Export.
+func (ks *Keystore) Import(name string, exported, passphrase []byte) error {
+	priv, err := decryptKey(exported, passphrase)
+	if err != nil {
+		return err
+	}
+	return ks.Put(name, priv)
+}
+
+//NewHost creates a host whose identity is the Ed25519 key of name, which is generated if it does not exist.
+//The peer ID is kept across restarts and reinstalls as long as the keystore is kept.
+func (ks *Keystore) NewHost(hGen pv.HostGenerator, name string) (host.Host, error) {
+	priv, err := ks.LoadOrGenerate(name)
+	if err != nil {
+		return nil, err
+	}
+	if priv.Type() != p2pcrypto.Ed25519 {
+		return nil, fmt.Errorf("key %q is not an Ed25519 key", name)
+	}
+	return pv.HostFromKey(hGen, priv)
+}
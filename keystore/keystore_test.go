@@ -0,0 +1,112 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	pv "github.com/pilinsin/p2p-verse"
+)
+
+func checkError(t *testing.T, err error, args ...interface{}) {
+	if err != nil {
+		args0 := make([]interface{}, len(args)+1)
+		args0[0] = err
+		copy(args0[1:], args)
+
+		t.Fatal(args0...)
+	}
+}
+func assertError(t *testing.T, cond bool, args ...interface{}) {
+	if !cond {
+		t.Fatal(args...)
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	checkError(t, err)
+	defer os.RemoveAll(dir)
+	pass := []byte("passphrase")
+
+	ks, err := Open(dir, pass)
+	checkError(t, err)
+	priv, err := ks.LoadOrGenerate("store")
+	checkError(t, err)
+	hostKey, err := ks.LoadOrGenerate("host")
+	checkError(t, err)
+	assertError(t, ks.Put("store", priv) == ErrKeyExists, "a key must not be overwritten")
+	assertError(t, ks.Put("../store", priv) != nil, "an invalid name must be rejected")
+	names, err := ks.List()
+	checkError(t, err)
+	assertError(t, len(names) == 2 && names[0] == "host" && names[1] == "store", "invalid names:", names)
+
+	m, err := ioutil.ReadFile(ks.path("store"))
+	checkError(t, err)
+	raw, err := priv.Raw()
+	checkError(t, err)
+	assertError(t, !bytes.Contains(m, raw[:32]), "the key must be encrypted")
+
+	//reopen as after a reinstall
+	_, err = Open(dir, []byte("wrong"))
+	assertError(t, errors.Is(err, ErrWrongPassphrase), "a wrong passphrase must be rejected:", err)
+	ks, err = Open(dir, pass)
+	checkError(t, err)
+	priv2, err := ks.LoadOrGenerate("store")
+	checkError(t, err)
+	assertError(t, priv.Equals(priv2), "the saved key must be loaded")
+
+	sign, err := priv2.Sign([]byte("data"))
+	checkError(t, err)
+	ok, err := priv.GetPublic().Verify([]byte("data"), sign)
+	assertError(t, err == nil && ok, "the loaded key must sign as the saved key")
+
+	h, err := ks.NewHost(pv.SampleHost, "host")
+	checkError(t, err)
+	pid, _ := peer.IDFromPrivateKey(hostKey)
+	assertError(t, h.ID() == pid, "the host must have the saved identity")
+	h.Close()
+
+	//export and import
+	exported, err := ks.Export("store", []byte("export"))
+	checkError(t, err)
+	dir2, err := ioutil.TempDir("", "keystore")
+	checkError(t, err)
+	defer os.RemoveAll(dir2)
+	ks2, err := Open(dir2, []byte("other"))
+	checkError(t, err)
+	assertError(t, ks2.Import("imported", exported, pass) != nil, "the export passphrase must be required")
+	checkError(t, ks2.Import("imported", exported, []byte("export")))
+	priv3, err := ks2.Get("imported")
+	checkError(t, err)
+	assertError(t, priv.Equals(priv3), "the imported key must equal the exported key")
+
+	//a key with too large argon2 parameters is rejected before the derivation
+	ek := &encryptedKey{}
+	checkError(t, json.Unmarshal(exported, ek))
+	ek.Memory = maxArgonMemory + 1
+	crafted, err := json.Marshal(ek)
+	checkError(t, err)
+	err = ks2.Import("crafted", crafted, []byte("export"))
+	assertError(t, err != nil && !errors.Is(err, ErrWrongPassphrase), "too large argon2 parameters must be rejected:", err)
+
+	//keys other than Ed25519
+	secp, _, err := p2pcrypto.GenerateSecp256k1Key(nil)
+	checkError(t, err)
+	checkError(t, ks2.Put("secp", secp))
+	secp2, err := ks2.Get("secp")
+	checkError(t, err)
+	assertError(t, secp.Equals(secp2), "a Secp256k1 key must be saved")
+
+	checkError(t, ks2.Delete("secp"))
+	_, err = ks2.Get("secp")
+	assertError(t, err == ErrKeyNotFound, "the deleted key must not be found")
+	has, err := ks2.Has("imported")
+	assertError(t, err == nil && has, "the imported key must exist")
+}
@@ -0,0 +1,138 @@
+package p2pverse
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+//Logger is a leveled logger with key-value fields.
+//With returns a Logger which adds fields to every message.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	With(fields ...Field) Logger
+}
+
+type textLogger struct {
+	mutex  *sync.Mutex
+	w      io.Writer
+	level  LogLevel
+	fields []Field
+}
+
+//NewLogger writes the messages of level or higher to w as
+//	2006-01-02T15:04:05Z07:00 LEVEL msg key=value ...
+func NewLogger(w io.Writer, level LogLevel) Logger {
+	return &textLogger{&sync.Mutex{}, w, level, nil}
+}
+func (l *textLogger) Debug(msg string, fields ...Field) {
+	l.log(LevelDebug, msg, fields)
+}
+func (l *textLogger) Info(msg string, fields ...Field) {
+	l.log(LevelInfo, msg, fields)
+}
+func (l *textLogger) Warn(msg string, fields ...Field) {
+	l.log(LevelWarn, msg, fields)
+}
+func (l *textLogger) Error(msg string, fields ...Field) {
+	l.log(LevelError, msg, fields)
+}
+func (l *textLogger) With(fields ...Field) Logger {
+	fs := make([]Field, 0, len(l.fields)+len(fields))
+	fs = append(fs, l.fields...)
+	fs = append(fs, fields...)
+	return &textLogger{l.mutex, l.w, l.level, fs}
+}
+func (l *textLogger) log(level LogLevel, msg string, fields []Field) {
+	if level < l.level {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(time.Now().Format(time.RFC3339))
+	sb.WriteString(" " + level.String() + " " + msg)
+	for _, fs := range [][]Field{l.fields, fields} {
+		for _, f := range fs {
+			fmt.Fprintf(&sb, " %s=%v", f.Key, f.Value)
+		}
+	}
+	sb.WriteString("\n")
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	io.WriteString(l.w, sb.String())
+}
+
+type nopLogger struct{}
+
+//NopLogger discards all messages, e.g. in tests.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+func (nopLogger) Debug(string, ...Field) {}
+func (nopLogger) Info(string, ...Field)  {}
+func (nopLogger) Warn(string, ...Field)  {}
+func (nopLogger) Error(string, ...Field) {}
+func (l nopLogger) With(...Field) Logger {
+	return l
+}
+
+var (
+	loggerMutex   sync.RWMutex
+	defaultLogger = NewLogger(os.Stderr, LevelInfo)
+)
+
+//DefaultLogger is used if no Logger is injected.
+func DefaultLogger() Logger {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	return defaultLogger
+}
+
+//SetDefaultLogger replaces the DefaultLogger, which writes Info or higher to os.Stderr.
+func SetDefaultLogger(l Logger) {
+	if l == nil {
+		l = NopLogger()
+	}
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	defaultLogger = l
+}
@@ -0,0 +1,342 @@
+package p2pverse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type MetricType string
+
+const (
+	CounterMetric MetricType = "counter"
+	GaugeMetric   MetricType = "gauge"
+	//a summary without quantiles, which has _sum and _count
+	SummaryMetric MetricType = "summary"
+)
+
+//Sample is a value of a metric.
+//Labels are key-value pairs, e.g. []string{"store", name}.
+type Sample struct {
+	Name   string
+	Labels []string
+	Value  float64
+}
+
+//Collector returns the samples computed at the time of the collection, e.g. gauges of the current state.
+type Collector interface {
+	Collect() []Sample
+}
+
+type CollectorFunc func() []Sample
+
+func (f CollectorFunc) Collect() []Sample {
+	return f()
+}
+
+type metricDesc struct {
+	typ  MetricType
+	help string
+}
+
+//Metrics is a registry of counters, gauges and summaries exported in the Prometheus text format.
+type Metrics struct {
+	mutex      sync.Mutex
+	descs      map[string]metricDesc
+	values     map[string]map[string]*Sample
+	collectors map[int]Collector
+	nextID     int
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		descs:      make(map[string]metricDesc),
+		values:     make(map[string]map[string]*Sample),
+		collectors: make(map[int]Collector),
+	}
+	for name, desc := range builtinMetrics {
+		m.descs[name] = desc
+	}
+	return m
+}
+
+//the metrics recorded by the packages of p2p-verse
+var builtinMetrics = map[string]metricDesc{
+	"p2pverse_store_puts_total":                 {CounterMetric, "The number of values put into a crdt store."},
+	"p2pverse_store_deletes_total":              {CounterMetric, "The number of values deleted from a crdt store."},
+	"p2pverse_store_validator_rejections_total": {CounterMetric, "The number of crdt deltas rejected by the validator of a store."},
+	"p2pverse_store_sync_seconds":               {SummaryMetric, "The duration of the syncs of a crdt store."},
+	"p2pverse_store_dag_heads":                  {GaugeMetric, "The number of the DAG heads of a crdt store."},
+	"p2pverse_store_connected_peers":            {GaugeMetric, "The number of the topic peers of a crdt store."},
+	"p2pverse_ipfs_blocks_added_total":          {CounterMetric, "The number of blocks added to an ipfs store."},
+	"p2pverse_ipfs_bytes_added_total":           {CounterMetric, "The number of bytes added to an ipfs store."},
+	"p2pverse_ipfs_blocks_fetched_total":        {CounterMetric, "The number of blocks fetched from an ipfs store."},
+	"p2pverse_ipfs_bytes_fetched_total":         {CounterMetric, "The number of bytes fetched from an ipfs store."},
+	"p2pverse_pubsub_messages_published_total":  {CounterMetric, "The number of messages published to a pubsub room."},
+	"p2pverse_pubsub_messages_received_total":   {CounterMetric, "The number of messages received from a pubsub room."},
+	"p2pverse_pubsub_messages_dropped_total":    {CounterMetric, "The number of malformed messages dropped by a pubsub room."},
+}
+
+var defaultMetrics = NewMetrics()
+
+//DefaultMetrics is the registry used by the stores and rooms of p2p-verse.
+func DefaultMetrics() *Metrics {
+	return defaultMetrics
+}
+
+//Describe sets the type and the help text of name.
+//A metric which is not described is exported as untyped.
+func (m *Metrics) Describe(name string, typ MetricType, help string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.descs[name] = metricDesc{typ, help}
+}
+
+func labelsKey(labels []string) string {
+	return strings.Join(labels, "\xff")
+}
+func (m *Metrics) sample(name string, labels []string) *Sample {
+	vs, ok := m.values[name]
+	if !ok {
+		vs = make(map[string]*Sample)
+		m.values[name] = vs
+	}
+	key := labelsKey(labels)
+	s, ok := vs[key]
+	if !ok {
+		s = &Sample{name, append([]string{}, labels...), 0}
+		vs[key] = s
+	}
+	return s
+}
+
+//Add adds delta to a counter or a gauge.
+func (m *Metrics) Add(name string, delta float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sample(name, labels).Value += delta
+}
+func (m *Metrics) Inc(name string, labels ...string) {
+	m.Add(name, 1, labels...)
+}
+
+//Set sets a gauge.
+func (m *Metrics) Set(name string, value float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sample(name, labels).Value = value
+}
+
+//Observe adds value to the _sum and 1 to the _count of a summary.
+func (m *Metrics) Observe(name string, value float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sample(name+"_sum", labels).Value += value
+	m.sample(name+"_count", labels).Value++
+}
+
+//Delete removes the samples of name with labels.
+func (m *Metrics) Delete(name string, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := labelsKey(labels)
+	for _, n := range []string{name, name + "_sum", name + "_count"} {
+		if vs, ok := m.values[n]; ok {
+			delete(vs, key)
+		}
+	}
+}
+
+//Register adds c to the collection until the returned unregister is called.
+func (m *Metrics) Register(c Collector) (unregister func()) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	id := m.nextID
+	m.nextID++
+	m.collectors[id] = c
+	return func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		delete(m.collectors, id)
+	}
+}
+
+//Samples returns the recorded and the collected samples sorted by name and labels.
+func (m *Metrics) Samples() []Sample {
+	m.mutex.Lock()
+	samples := make([]Sample, 0)
+	for _, vs := range m.values {
+		for _, s := range vs {
+			samples = append(samples, *s)
+		}
+	}
+	collectors := make([]Collector, 0, len(m.collectors))
+	for _, c := range m.collectors {
+		collectors = append(collectors, c)
+	}
+	m.mutex.Unlock()
+
+	for _, c := range collectors {
+		samples = append(samples, c.Collect()...)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].Name != samples[j].Name {
+			return samples[i].Name < samples[j].Name
+		}
+		return labelsKey(samples[i].Labels) < labelsKey(samples[j].Labels)
+	})
+	return samples
+}
+
+//Value returns the sum of the samples of name whose labels contain labels.
+func (m *Metrics) Value(name string, labels ...string) float64 {
+	sum := 0.0
+	for _, s := range m.Samples() {
+		if s.Name == name && hasLabels(s.Labels, labels) {
+			sum += s.Value
+		}
+	}
+	return sum
+}
+func hasLabels(labels, sub []string) bool {
+	for i := 0; i+1 < len(sub); i += 2 {
+		found := false
+		for j := 0; j+1 < len(labels); j += 2 {
+			if labels[j] == sub[i] && labels[j+1] == sub[i+1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Metrics) familyName(name string) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.descs[name]; ok {
+		return name
+	}
+	for _, suffix := range []string{"_sum", "_count"} {
+		base := strings.TrimSuffix(name, suffix)
+		if d, ok := m.descs[base]; ok && base != name && d.typ == SummaryMetric {
+			return base
+		}
+	}
+	return name
+}
+func (m *Metrics) desc(name string) (metricDesc, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	d, ok := m.descs[name]
+	return d, ok
+}
+
+//WriteTo writes the samples in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	write := func(s string) {
+		k, _ := bw.WriteString(s)
+		n += int64(k)
+	}
+
+	samples := m.Samples()
+	families := make([]string, len(samples))
+	for idx, s := range samples {
+		families[idx] = m.familyName(s.Name)
+	}
+	idxs := make([]int, len(samples))
+	for idx := range idxs {
+		idxs[idx] = idx
+	}
+	sort.SliceStable(idxs, func(i, j int) bool {
+		return families[idxs[i]] < families[idxs[j]]
+	})
+
+	family := ""
+	for _, idx := range idxs {
+		s := samples[idx]
+		if f := families[idx]; f != family {
+			family = f
+			if d, ok := m.desc(f); ok {
+				write("# HELP " + f + " " + escapeHelp(d.help) + "\n")
+				write("# TYPE " + f + " " + string(d.typ) + "\n")
+			} else {
+				write("# TYPE " + f + " untyped\n")
+			}
+		}
+		write(s.Name + formatLabels(s.Labels) + " " + formatValue(s.Value) + "\n")
+	}
+	return n, bw.Flush()
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+r.Replace(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+//Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WriteTo(w)
+	})
+}
+
+//ServeMetrics serves m at http://addr/metrics until ctx is done.
+//addr should be a local address such as "127.0.0.1:9090".
+func ServeMetrics(ctx context.Context, addr string, m *Metrics) error {
+	if m == nil {
+		return errors.New("no metrics are given")
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	srv := &http.Server{Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
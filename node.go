@@ -0,0 +1,165 @@
+package p2pverse
+
+import (
+	"context"
+	"os"
+
+	ipfslt "github.com/hsanjuan/ipfs-lite"
+	ds "github.com/ipfs/go-datastore"
+	badger "github.com/ipfs/go-ds-badger2"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	p2ppubsub "github.com/libp2p/go-libp2p-pubsub"
+	multierr "go.uber.org/multierr"
+)
+
+//Node owns one host, one DHT, one GossipSub router and one ipfs-lite peer.
+//crdt stores, ipfs stores and pubsub rooms opened from the same Node share them.
+type Node struct {
+	ctx        context.Context
+	cancel     func()
+	dsCancel   func()
+	closeStore bool
+	h          host.Host
+	dht        *DiscoveryDHT
+	dStore     ds.Batching
+	ps         *p2ppubsub.PubSub
+	ipfs       *ipfslt.Peer
+	bootstraps []peer.AddrInfo
+}
+
+//NewNode opens a badger datastore at dirPath for the ipfs blocks of the Node.
+//If save is false, dirPath is removed when the Node is closed.
+func NewNode(hGen HostGenerator, dirPath string, save bool, bootstraps ...peer.AddrInfo) (*Node, error) {
+	if err := os.MkdirAll(dirPath, 0700); err != nil {
+		return nil, err
+	}
+	dsCancel := func() {}
+	if !save {
+		dsCancel = func() { os.RemoveAll(dirPath) }
+	}
+
+	stOpts := badger.DefaultOptions
+	stOpts.InMemory = false
+	store, err := badger.NewDatastore(dirPath, &stOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := NewNodeWithDatastore(hGen, store, bootstraps...)
+	if err != nil {
+		store.Close()
+		dsCancel()
+		return nil, err
+	}
+	n.dsCancel = dsCancel
+	n.closeStore = true
+	return n, nil
+}
+
+//NewNodeWithDatastore uses dStore for the ipfs blocks of the Node.
+//dStore is not closed by Node.Close.
+func NewNodeWithDatastore(hGen HostGenerator, dStore ds.Batching, bootstraps ...peer.AddrInfo) (*Node, error) {
+	h, err := hGen()
+	if err != nil {
+		return nil, err
+	}
+	dht, err := NewDHT(h)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	psOpts := []p2ppubsub.Option{p2ppubsub.WithDiscovery(dht.Discovery())}
+	if g := HostGater(h); g != nil {
+		psOpts = append(psOpts, p2ppubsub.WithRawTracer(newGaterTracer(g, h.ID())))
+	}
+	gossip, err := p2ppubsub.NewGossipSub(ctx, h, psOpts...)
+	if err != nil {
+		cancel()
+		dht.Close()
+		h.Close()
+		return nil, err
+	}
+
+	ipfs, err := ipfslt.New(ctx, dStore, h, dht.DHT(), nil)
+	if err != nil {
+		cancel()
+		dht.Close()
+		h.Close()
+		return nil, err
+	}
+
+	return &Node{
+		ctx:        ctx,
+		cancel:     cancel,
+		dsCancel:   func() {},
+		h:          h,
+		dht:        dht,
+		dStore:     dStore,
+		ps:         gossip,
+		ipfs:       ipfs,
+		bootstraps: bootstraps,
+	}, nil
+}
+
+//AddDiscoverers creates Discoverers for the host of the Node and adds them to its DHT.
+//The GossipSub router of the Node also uses them.
+func (n *Node) AddDiscoverers(gens ...DiscovererGenerator) error {
+	for _, gen := range gens {
+		disc, err := gen(n.h)
+		if err != nil {
+			return err
+		}
+		n.dht.AddDiscoverer(disc)
+	}
+	return nil
+}
+
+//Close stops the GossipSub router and the ipfs-lite peer, and then closes the DHT, the host and the datastore in order.
+//The errors of all of them are returned together.
+func (n *Node) Close() error {
+	n.cancel()
+	err := n.dht.Close()
+	err = multierr.Append(err, n.h.Close())
+	if n.closeStore {
+		err = multierr.Append(err, n.dStore.Close())
+	}
+	n.dsCancel()
+	return err
+}
+
+//SetLogger replaces the Logger of the DHT of the Node.
+func (n *Node) SetLogger(l Logger) {
+	n.dht.SetLogger(l)
+}
+func (n *Node) Logger() Logger {
+	return n.dht.Logger()
+}
+func (n *Node) Context() context.Context {
+	return n.ctx
+}
+func (n *Node) Host() host.Host {
+	return n.h
+}
+func (n *Node) DHT() *DiscoveryDHT {
+	return n.dht
+}
+func (n *Node) PubSub() *p2ppubsub.PubSub {
+	return n.ps
+}
+
+//Gater returns nil if the host of the Node has no Gater.
+func (n *Node) Gater() *Gater {
+	return HostGater(n.h)
+}
+func (n *Node) IPFS() *ipfslt.Peer {
+	return n.ipfs
+}
+func (n *Node) Bootstraps() []peer.AddrInfo {
+	return n.bootstraps
+}
+func (n *Node) AddrInfo() peer.AddrInfo {
+	return HostToAddrInfo(n.h)
+}
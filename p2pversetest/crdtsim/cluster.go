@@ -0,0 +1,420 @@
+package crdtsim
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	multierr "go.uber.org/multierr"
+
+	pv "github.com/pilinsin/p2p-verse"
+	crdt "github.com/pilinsin/p2p-verse/crdt"
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
+)
+
+type Options struct {
+	//the number of the replicas (default: 3)
+	Replicas int
+	//a mode of crdtVerse.NewStore (default: "log")
+	Mode string
+	//the stores are wrapped by access stores, which is available for "hash", "signature" and "updatableSignature"
+	Access bool
+	//the workload writes Keys keys, so that the replicas write the same keys concurrently (default: 8)
+	Keys int
+	//the directory of the replicas, which is removed by Close (default: "crdtsim")
+	Dir string
+	//the seed of the workload and the identities (default: 1)
+	Seed int64
+	//the Logger of the stores (default: pv.NopLogger())
+	Logger pv.Logger
+}
+
+func getOptions(opts ...*Options) *Options {
+	opt := &Options{}
+	if len(opts) > 0 && opts[0] != nil {
+		*opt = *opts[0]
+	}
+	if opt.Replicas <= 0 {
+		opt.Replicas = 3
+	}
+	if opt.Mode == "" {
+		opt.Mode = "log"
+	}
+	if opt.Keys <= 0 {
+		opt.Keys = 8
+	}
+	if opt.Dir == "" {
+		opt.Dir = "crdtsim"
+	}
+	if opt.Seed == 0 {
+		opt.Seed = 1
+	}
+	if opt.Logger == nil {
+		opt.Logger = pv.NopLogger()
+	}
+	return opt
+}
+
+type replica struct {
+	seed []byte
+	pid  peer.ID
+	dir  string
+	opt  *crdt.StoreOpts
+	st   crdt.IStore
+}
+
+//Cluster runs the replicas of a crdt store on a p2pversetest.Network.
+//The faults of the network are injected by Partition, SetLatency, SetLoss and Restart.
+type Cluster struct {
+	mutex    sync.Mutex
+	net      *p2pversetest.Network
+	bstrp    pv.IBootstrap
+	opt      *Options
+	rand     *rand.Rand
+	address  string
+	keys     []string
+	replicas []*replica
+}
+
+//NewCluster creates the first replica and loads the others from its address.
+func NewCluster(n *p2pversetest.Network, opts ...*Options) (*Cluster, error) {
+	opt := getOptions(opts...)
+	if opt.Access && opt.Mode != "hash" && opt.Mode != "signature" && opt.Mode != "updatableSignature" {
+		return nil, fmt.Errorf("no access store for %s mode", opt.Mode)
+	}
+	bstrp, err := pv.NewBootstrap(n.HostGenerator())
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cluster{
+		net:   n,
+		bstrp: bstrp,
+		opt:   opt,
+		rand:  rand.New(rand.NewSource(opt.Seed)),
+	}
+	for idx := 0; idx < opt.Keys; idx++ {
+		c.keys = append(c.keys, "k"+strconv.Itoa(idx))
+	}
+	for idx := 0; idx < opt.Replicas; idx++ {
+		r, err := c.newReplica(idx)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.replicas = append(c.replicas, r)
+	}
+
+	if err := c.createStore(c.replicas[0]); err != nil {
+		c.Close()
+		return nil, err
+	}
+	for _, r := range c.replicas[1:] {
+		if err := c.start(r); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Cluster) newReplica(idx int) (*replica, error) {
+	seed := make([]byte, 32)
+	c.rand.Read(seed)
+	priv, _, err := p2pcrypto.GenerateEd25519Key(bytes.NewReader(seed))
+	if err != nil {
+		return nil, err
+	}
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	sPriv, sPub, err := p2pcrypto.GenerateEd25519Key(c.rand)
+	if err != nil {
+		return nil, err
+	}
+	return &replica{
+		seed: seed,
+		pid:  pid,
+		dir:  filepath.Join(c.opt.Dir, "r"+strconv.Itoa(idx)),
+		opt:  &crdt.StoreOpts{Priv: sPriv, Pub: sPub, Logger: c.opt.Logger},
+	}, nil
+}
+
+//the host of a replica keeps its peer ID across restarts, so that it stays in its partition.
+func (c *Cluster) hostGenerator(r *replica) pv.HostGenerator {
+	return func(...io.Reader) (host.Host, error) {
+		return c.net.NewHost(bytes.NewReader(r.seed))
+	}
+}
+
+func (c *Cluster) createStore(r *replica) error {
+	if c.opt.Mode == "hash" {
+		r.opt.Salt = make([]byte, 8)
+		c.rand.Read(r.opt.Salt)
+	}
+	v := crdt.NewVerse(c.hostGenerator(r), r.dir, true, c.bstrp.AddrInfo())
+	st, err := v.NewStore("sim", c.opt.Mode, r.opt)
+	if err != nil {
+		return err
+	}
+
+	if c.opt.Access {
+		accesses := make(chan string)
+		go func() {
+			defer close(accesses)
+			for _, access := range c.accesses(r) {
+				accesses <- access
+			}
+		}()
+		ac, err := v.NewAccessStore(st, accesses)
+		if err != nil {
+			return err
+		}
+		st = ac
+	}
+	r.st = st
+	c.address = st.Address()
+	return nil
+}
+
+//the signature stores are granted to the public keys of the replicas,
+//and the hash store is granted to the keys of the workload.
+func (c *Cluster) accesses(r *replica) []string {
+	accesses := make([]string, 0)
+	if c.opt.Mode == "hash" {
+		for _, key := range c.keys {
+			accesses = append(accesses, crdt.MakeHashKey(key, r.opt.Salt))
+		}
+		return accesses
+	}
+	for _, r := range c.replicas {
+		accesses = append(accesses, crdt.PubKeyToStr(r.opt.Pub))
+	}
+	return accesses
+}
+
+func (c *Cluster) start(r *replica) error {
+	if r.st != nil {
+		return nil
+	}
+	v := crdt.NewVerse(c.hostGenerator(r), r.dir, true, c.bstrp.AddrInfo())
+	st, err := v.NewStore(c.address, c.opt.Mode, r.opt)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return errors.New("load failed")
+	}
+	r.st = st
+	return nil
+}
+
+func (c *Cluster) replica(idx int) (*replica, error) {
+	if idx < 0 || idx >= len(c.replicas) {
+		return nil, fmt.Errorf("no replica %d", idx)
+	}
+	return c.replicas[idx], nil
+}
+
+//Close closes all the replicas and the bootstrap, and removes the directories of the replicas.
+func (c *Cluster) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var err error
+	for _, r := range c.replicas {
+		if r.st != nil {
+			err = multierr.Append(err, r.st.Close())
+			r.st = nil
+		}
+	}
+	err = multierr.Append(err, c.bstrp.Close())
+	return multierr.Append(err, os.RemoveAll(c.opt.Dir))
+}
+
+func (c *Cluster) Address() string {
+	return c.address
+}
+
+//Store returns the store of replica idx, which is nil while the replica is stopped.
+func (c *Cluster) Store(idx int) crdt.IStore {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, err := c.replica(idx)
+	if err != nil {
+		return nil
+	}
+	return r.st
+}
+
+func (c *Cluster) PeerID(idx int) peer.ID {
+	r, err := c.replica(idx)
+	if err != nil {
+		return ""
+	}
+	return r.pid
+}
+
+//Partition splits the replicas into groups of indices.
+//The bootstrap stays connectable to all replicas.
+func (c *Cluster) Partition(groups ...[]int) error {
+	pGroups := make([][]peer.ID, len(groups))
+	for gIdx, group := range groups {
+		for _, idx := range group {
+			r, err := c.replica(idx)
+			if err != nil {
+				return err
+			}
+			pGroups[gIdx] = append(pGroups[gIdx], r.pid)
+		}
+	}
+	return c.net.Partition(pGroups...)
+}
+
+//Heal removes the partition of the replicas.
+func (c *Cluster) Heal() error {
+	return c.net.Heal()
+}
+func (c *Cluster) SetLatency(d time.Duration) {
+	c.net.SetLatency(d)
+}
+func (c *Cluster) SetLoss(rate float64) {
+	c.net.SetLoss(rate)
+}
+
+//Stop closes the store of replica idx and keeps its directory.
+func (c *Cluster) Stop(idx int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, err := c.replica(idx)
+	if err != nil {
+		return err
+	}
+	if r.st == nil {
+		return nil
+	}
+	err = r.st.Cancel()
+	r.st = nil
+	return err
+}
+
+//Start reopens the store of replica idx from its directory.
+func (c *Cluster) Start(idx int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, err := c.replica(idx)
+	if err != nil {
+		return err
+	}
+	return c.start(r)
+}
+
+func (c *Cluster) Restart(idx int) error {
+	if err := c.Stop(idx); err != nil {
+		return err
+	}
+	return c.Start(idx)
+}
+
+//Put writes to replica idx.
+func (c *Cluster) Put(idx int, key string, val []byte) error {
+	st := c.Store(idx)
+	if st == nil {
+		return fmt.Errorf("replica %d is stopped", idx)
+	}
+	return st.Put(key, val)
+}
+
+//RandomPuts writes n random values of random keys to random running replicas,
+//and returns the number of the accepted writes.
+//The writes rejected by crdt.ErrAlreadyExist, e.g. of a log store, are not errors.
+func (c *Cluster) RandomPuts(n int) (int, error) {
+	accepted := 0
+	for i := 0; i < n; i++ {
+		c.mutex.Lock()
+		idx := c.rand.Intn(len(c.replicas))
+		key := c.keys[c.rand.Intn(len(c.keys))]
+		val := make([]byte, 16)
+		c.rand.Read(val)
+		c.mutex.Unlock()
+
+		if c.Store(idx) == nil {
+			continue
+		}
+		err := c.Put(idx, key, val)
+		if err == crdt.ErrAlreadyExist {
+			continue
+		}
+		if err != nil {
+			return accepted, fmt.Errorf("put %s to replica %d: %w", key, idx, err)
+		}
+		accepted++
+	}
+	return accepted, nil
+}
+
+//the interval at which WaitConverged reconnects the replicas while they are not converged
+var ReconnectInterval = time.Second * 30
+
+//WaitConverged waits until the Query results of all the running replicas are the same.
+//The access stores also wait for all the grants, which are not in the Query results.
+//The replicas are reconnected every ReconnectInterval, since bitswap may lose the wants to a peer after the faults.
+func (c *Cluster) WaitConverged(ctx context.Context) error {
+	c.mutex.Lock()
+	sts := make([]crdt.IStore, 0, len(c.replicas))
+	qs := make([]p2pversetest.Querier, 0, len(c.replicas))
+	for _, r := range c.replicas {
+		if r.st != nil {
+			sts = append(sts, r.st)
+			qs = append(qs, r.st)
+		}
+	}
+	accesses := c.accesses(c.replicas[0])
+	c.mutex.Unlock()
+
+	for {
+		wCtx, cancel := context.WithTimeout(ctx, ReconnectInterval)
+		err := c.waitGranted(wCtx, sts, accesses)
+		if err == nil {
+			err = p2pversetest.WaitConverged(wCtx, qs)
+		}
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if err := c.net.Reconnect(); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Cluster) waitGranted(ctx context.Context, sts []crdt.IStore, accesses []string) error {
+	if !c.opt.Access {
+		return nil
+	}
+	return p2pversetest.WaitNoError(ctx, func() error {
+		for idx, st := range sts {
+			ac, ok := st.(crdt.IAccessStore)
+			if !ok {
+				return fmt.Errorf("store %d is not an access store", idx)
+			}
+			for _, access := range accesses {
+				if err := ac.Verify(access); err != nil {
+					return fmt.Errorf("store %d: %w", idx, err)
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,100 @@
+package crdtsim
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
+)
+
+func checkError(t *testing.T, err error, args ...interface{}) {
+	if err != nil {
+		args0 := make([]interface{}, len(args)+1)
+		args0[0] = err
+		copy(args0[1:], args)
+
+		t.Fatal(args0...)
+	}
+}
+
+func waitConverged(t *testing.T, c *Cluster, args ...interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*3)
+	defer cancel()
+	if err := c.WaitConverged(ctx); err != nil {
+		t.Fatal(append([]interface{}{err}, args...)...)
+	}
+}
+
+func testConvergence(t *testing.T, opt *Options) {
+	n := p2pversetest.NewNetwork()
+	defer n.Close()
+
+	c, err := NewCluster(n, opt)
+	checkError(t, err)
+	defer c.Close()
+	//the grants of the access stores are synced before the puts
+	waitConverged(t, c, "after load")
+
+	_, err = c.RandomPuts(10)
+	checkError(t, err)
+	waitConverged(t, c, "before partition")
+	first, err := p2pversetest.Snapshot(c.Store(0))
+	checkError(t, err)
+
+	checkError(t, c.Partition([]int{0}, []int{1, 2}))
+	c.SetLatency(time.Millisecond * 10)
+	_, err = c.RandomPuts(20)
+	checkError(t, err)
+
+	c.SetLoss(0.2)
+	checkError(t, c.Restart(1))
+	_, err = c.RandomPuts(10)
+	checkError(t, err)
+	c.SetLoss(0)
+
+	c.SetLatency(0)
+	checkError(t, c.Heal())
+	//the heads written after the heal link the branches written during the faults
+	_, err = c.RandomPuts(10)
+	checkError(t, err)
+	waitConverged(t, c, "after heal")
+	//the values of an updatable store are replaced by the later writes
+	if opt.Mode != "updatable" && opt.Mode != "updatableSignature" {
+		checkFirstValues(t, c, first)
+	}
+}
+
+//the values converged before the partition are the first ones of their keys,
+//which are kept on every replica through the concurrent writes of the same keys.
+func checkFirstValues(t *testing.T, c *Cluster, first map[string][]byte) {
+	for idx := 0; c.PeerID(idx) != ""; idx++ {
+		kvs, err := p2pversetest.Snapshot(c.Store(idx))
+		checkError(t, err)
+		for key, val := range first {
+			if !bytes.Equal(kvs[key], val) {
+				t.Fatalf("replica %d: the first value of %s is replaced", idx, key)
+			}
+		}
+	}
+}
+
+func TestConvergence(t *testing.T) {
+	opts := []*Options{
+		{Mode: "log", Dir: "sl"},
+		{Mode: "updatable", Dir: "su"},
+		{Mode: "hash", Dir: "sh"},
+		{Mode: "signature", Dir: "ss"},
+		{Mode: "updatableSignature", Dir: "sus"},
+		{Mode: "hash", Access: true, Dir: "sah"},
+		{Mode: "signature", Access: true, Dir: "sas"},
+		{Mode: "updatableSignature", Access: true, Dir: "saus"},
+	}
+	for _, opt := range opts {
+		opt := opt
+		t.Run(opt.Dir, func(t *testing.T) {
+			testConvergence(t, opt)
+		})
+	}
+}
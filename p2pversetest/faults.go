@@ -0,0 +1,153 @@
+package p2pversetest
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+//the interval at which SetLoss cuts links, which is also the outage of a cut link
+var LossInterval = time.Millisecond * 200
+
+//linkable reports whether a and b are in the same partition.
+//A host which is in no group, e.g. a bootstrap, is linkable to all hosts.
+func (n *Network) linkable(a, b peer.ID) bool {
+	ga, okA := n.groups[a]
+	gb, okB := n.groups[b]
+	return !okA || !okB || ga == gb
+}
+
+func (n *Network) link(a, b peer.ID) error {
+	if len(n.mn.LinksBetweenPeers(a, b)) > 0 {
+		return nil
+	}
+	_, err := n.mn.LinkPeers(a, b)
+	return err
+}
+
+//relink links the hosts in the same partition and disconnects the others.
+func (n *Network) relink() error {
+	peers := n.mn.Peers()
+	for idx, a := range peers {
+		for _, b := range peers[idx+1:] {
+			if n.linkable(a, b) {
+				if err := n.link(a, b); err != nil {
+					return err
+				}
+				continue
+			}
+			if len(n.mn.LinksBetweenPeers(a, b)) > 0 {
+				if err := n.mn.UnlinkPeers(a, b); err != nil {
+					return err
+				}
+			}
+			n.mn.DisconnectPeers(a, b)
+			n.mn.DisconnectPeers(b, a)
+		}
+	}
+	return nil
+}
+
+//Partition splits the hosts into groups which cannot connect to each other until Heal is called.
+//The hosts which are in no group, e.g. bootstraps, stay connectable to all hosts.
+//A host created later with the peer ID of a group joins the group.
+func (n *Network) Partition(groups ...[]peer.ID) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.groups = make(map[peer.ID]int)
+	for idx, group := range groups {
+		for _, pid := range group {
+			n.groups[pid] = idx
+		}
+	}
+	return n.relink()
+}
+
+//Heal removes the partition.
+func (n *Network) Heal() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.groups = nil
+	return n.reconnect()
+}
+
+//Reconnect cuts all the connections for LossInterval like after a real outage, and then links the hosts again.
+//bitswap may lose the wants to a peer which reconnected during the faults until the peer is disconnected again.
+func (n *Network) Reconnect() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.reconnect()
+}
+
+func (n *Network) reconnect() error {
+	n.cut(1)
+	time.Sleep(LossInterval)
+	return n.relink()
+}
+
+//SetLatency delays every message between the hosts by d.
+func (n *Network) SetLatency(d time.Duration) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	opt := mocknet.LinkOptions{Latency: d}
+	n.mn.SetLinkDefaults(opt)
+	for _, bs := range n.mn.Links() {
+		for _, ls := range bs {
+			for l := range ls {
+				l.SetOptions(opt)
+			}
+		}
+	}
+}
+
+//SetLoss cuts the link of each pair of connected hosts with probability rate every LossInterval until SetLoss(0) is called.
+//The messages in flight between the hosts are lost, and the link is restored at the next LossInterval.
+//The hosts cannot reconnect before that, since pubsub takes a quick reconnection for a duplicate connection
+//and fails after a few of them.
+func (n *Network) SetLoss(rate float64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.lossCancel != nil {
+		n.lossCancel()
+		n.lossCancel = nil
+		n.relink()
+	}
+	if rate <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.lossCancel = cancel
+	go func() {
+		ticker := time.NewTicker(LossInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			n.mutex.Lock()
+			if ctx.Err() == nil {
+				n.relink()
+				n.cut(rate)
+			}
+			n.mutex.Unlock()
+		}
+	}()
+}
+
+func (n *Network) cut(rate float64) {
+	for _, nw := range n.mn.Nets() {
+		for _, pid := range nw.Peers() {
+			if nw.LocalPeer() < pid && rand.Float64() < rate {
+				n.mn.UnlinkPeers(nw.LocalPeer(), pid)
+				n.mn.DisconnectPeers(nw.LocalPeer(), pid)
+				n.mn.DisconnectPeers(pid, nw.LocalPeer())
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package p2pversetest
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+//LeakChecker finds the goroutines which run the functions of some packages, e.g. after the stores are closed.
+//The goroutines already running when the LeakChecker is created are ignored,
+//so that the leaks of the other tests in the same binary do not matter.
+type LeakChecker struct {
+	prefixes []string
+	ignored  map[string]struct{}
+}
+
+//a goroutine is checked if one of its frames starts with one of prefixes,
+//e.g. "github.com/pilinsin/p2p-verse/crdt." for the crdt package.
+func NewLeakChecker(prefixes ...string) *LeakChecker {
+	lc := &LeakChecker{prefixes: prefixes, ignored: make(map[string]struct{})}
+	for id := range lc.goroutines() {
+		lc.ignored[id] = struct{}{}
+	}
+	return lc
+}
+
+//goroutines returns the stacks of the checked goroutines by their IDs except the calling goroutine.
+func (lc *LeakChecker) goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+
+	gs := make(map[string]string)
+	//the first stack is of the calling goroutine
+	for _, stack := range strings.Split(string(buf), "\n\n")[1:] {
+		header := strings.SplitN(stack, " ", 3)
+		if len(header) < 3 || header[0] != "goroutine" {
+			continue
+		}
+		if lc.match(stack) {
+			gs[header[1]] = stack
+		}
+	}
+	return gs
+}
+func (lc *LeakChecker) match(stack string) bool {
+	for _, line := range strings.Split(stack, "\n") {
+		line = strings.TrimPrefix(line, "created by ")
+		for _, prefix := range lc.prefixes {
+			if strings.HasPrefix(line, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//Leaks returns the stacks of the checked goroutines started after the LeakChecker was created.
+func (lc *LeakChecker) Leaks() []string {
+	leaks := make([]string, 0)
+	for id, stack := range lc.goroutines() {
+		if _, ok := lc.ignored[id]; !ok {
+			leaks = append(leaks, stack)
+		}
+	}
+	return leaks
+}
+
+//Wait waits until no goroutine leaks.
+//The stacks of the leaked goroutines are returned in the error if ctx is done before.
+func (lc *LeakChecker) Wait(ctx context.Context) error {
+	return WaitNoError(ctx, func() error {
+		leaks := lc.Leaks()
+		if len(leaks) == 0 {
+			return nil
+		}
+		return fmt.Errorf("%d goroutines leaked:\n%s", len(leaks), strings.Join(leaks, "\n\n"))
+	})
+}
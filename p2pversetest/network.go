@@ -0,0 +1,126 @@
+package p2pversetest
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	eventbus "github.com/libp2p/go-eventbus"
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+	event "github.com/libp2p/go-libp2p-core/event"
+	host "github.com/libp2p/go-libp2p-core/host"
+	network "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+
+	pv "github.com/pilinsin/p2p-verse"
+)
+
+//the wait before a host created again with the same seed is linked,
+//so that pubsub of the other hosts does not take the new connections for duplicates of the closed ones.
+var RestartDelay = time.Millisecond * 500
+
+//Network is an in-memory network of libp2p hosts.
+//Every host created by NewHost can connect to every other host without TCP unless the network is partitioned.
+type Network struct {
+	mutex      sync.Mutex
+	mn         mocknet.Mocknet
+	groups     map[peer.ID]int
+	lossCancel func()
+}
+
+func NewNetwork() *Network {
+	return &Network{mn: mocknet.New()}
+}
+
+//Close closes all the hosts of the network.
+func (n *Network) Close() error {
+	n.SetLoss(0)
+	return n.mn.Close()
+}
+
+//Mocknet returns the underlying mocknet, e.g. to change the links between hosts.
+func (n *Network) Mocknet() mocknet.Mocknet {
+	return n.mn
+}
+
+//HostGenerator returns the HostGenerator of the network, which is usable in place of pv.SampleHost.
+func (n *Network) HostGenerator() pv.HostGenerator {
+	return n.NewHost
+}
+
+//NewHost creates a host whose Ed25519 key is derived from seeds like pv.SampleHost.
+//A host created again with the same seed replaces the closed one, e.g. to restart a node.
+func (n *Network) NewHost(seeds ...io.Reader) (host.Host, error) {
+	seed := io.Reader(rand.Reader)
+	if len(seeds) > 0 {
+		seed = seeds[0]
+	}
+	priv, _, err := p2pcrypto.GenerateEd25519Key(seed)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := mockAddr(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	others := n.mn.Peers()
+	for _, other := range others {
+		if other != pid {
+			continue
+		}
+		n.mn.Net(pid).Close()
+		for _, other := range others {
+			n.mn.UnlinkPeers(pid, other)
+		}
+		time.Sleep(RestartDelay)
+		break
+	}
+	h, err := n.mn.AddPeer(priv, addr)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range others {
+		if other == pid || !n.linkable(pid, other) {
+			continue
+		}
+		if _, err := n.mn.LinkPeers(pid, other); err != nil {
+			h.Close()
+			return nil, err
+		}
+	}
+
+	//the DHT runs in the server mode like the hosts of pv.SampleHost
+	em, err := h.EventBus().Emitter(new(event.EvtLocalReachabilityChanged), eventbus.Stateful)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+	if err := em.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}); err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+//mockAddr is a unique unroutable address of pid.
+func mockAddr(pid peer.ID) (ma.Multiaddr, error) {
+	suffix := []byte(pid)
+	if len(suffix) > 8 {
+		suffix = suffix[len(suffix)-8:]
+	}
+	ip := net.ParseIP("100::")
+	copy(ip[net.IPv6len-len(suffix):], suffix)
+	return ma.NewMultiaddr(fmt.Sprintf("/ip6/%s/tcp/4242", ip))
+}
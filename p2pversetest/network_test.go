@@ -0,0 +1,126 @@
+package p2pversetest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	network "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	pv "github.com/pilinsin/p2p-verse"
+)
+
+func checkError(t *testing.T, err error, args ...interface{}) {
+	if err != nil {
+		args0 := make([]interface{}, len(args)+1)
+		args0[0] = err
+		copy(args0[1:], args)
+
+		t.Fatal(args0...)
+	}
+}
+func assertError(t *testing.T, cond bool, args ...interface{}) {
+	if !cond {
+		t.Fatal(args...)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	n := NewNetwork()
+	defer n.Close()
+	hGen := n.HostGenerator()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	b, err := pv.NewBootstrap(hGen)
+	checkError(t, err)
+	defer b.Close()
+
+	hs := make([]*pv.DiscoveryDHT, 3)
+	for idx := range hs {
+		h, err := hGen()
+		checkError(t, err)
+		d, err := pv.NewDHT(h)
+		checkError(t, err)
+		defer d.Close()
+		checkError(t, d.BootstrapContext(ctx, "keyword", []peer.AddrInfo{b.AddrInfo()}))
+		hs[idx] = d
+	}
+
+	//the hosts are found by the DHT rendezvous of the keyword
+	h0 := hs[0].DHT().Host()
+	checkError(t, hs[0].ConnectPeers(ctx, "keyword", 5))
+	checkError(t, WaitConnected(ctx, h0, hs[1].DHT().Host().ID(), hs[2].DHT().Host().ID()))
+
+	//a host is restarted with the same identity
+	seed := bytes.Repeat([]byte{1}, 32)
+	h, err := hGen(bytes.NewReader(seed))
+	checkError(t, err)
+	pid := h.ID()
+	checkError(t, h.Connect(ctx, b.AddrInfo()))
+	h.Close()
+	h, err = hGen(bytes.NewReader(seed))
+	checkError(t, err)
+	defer h.Close()
+	assertError(t, h.ID() == pid, "the peer ID must be kept")
+	checkError(t, h.Connect(ctx, b.AddrInfo()))
+	checkError(t, WaitConnected(ctx, b.Host(), pid))
+
+	short, cancel2 := context.WithTimeout(ctx, time.Millisecond*200)
+	defer cancel2()
+	err = WaitFor(short, func() bool { return false })
+	assertError(t, err != nil, "WaitFor must time out")
+}
+
+func TestFaults(t *testing.T) {
+	n := NewNetwork()
+	defer n.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	hs := make([]host.Host, 3)
+	for idx := range hs {
+		h, err := n.NewHost()
+		checkError(t, err)
+		hs[idx] = h
+	}
+	ai := func(h host.Host) peer.AddrInfo {
+		return peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+	}
+
+	checkError(t, hs[0].Connect(ctx, ai(hs[1])))
+	checkError(t, n.Partition([]peer.ID{hs[0].ID()}, []peer.ID{hs[1].ID(), hs[2].ID()}))
+	assertError(t, hs[0].Network().Connectedness(hs[1].ID()) != network.Connected, "a partition must disconnect the groups")
+	assertError(t, hs[0].Connect(ctx, ai(hs[2])) != nil, "the groups must not be connectable")
+	checkError(t, hs[1].Connect(ctx, ai(hs[2])))
+
+	//a restarted host stays in its group
+	seed := bytes.Repeat([]byte{2}, 32)
+	h, err := n.NewHost(bytes.NewReader(seed))
+	checkError(t, err)
+	checkError(t, n.Partition([]peer.ID{hs[0].ID()}, []peer.ID{hs[1].ID(), h.ID()}))
+	h.Close()
+	h, err = n.NewHost(bytes.NewReader(seed))
+	checkError(t, err)
+	defer h.Close()
+	assertError(t, hs[0].Connect(ctx, ai(h)) != nil, "a restarted host must stay in its group")
+	checkError(t, hs[1].Connect(ctx, ai(h)))
+
+	checkError(t, n.Heal())
+	checkError(t, hs[0].Connect(ctx, ai(hs[2])))
+
+	n.SetLatency(time.Millisecond * 100)
+	start := time.Now()
+	checkError(t, hs[2].Connect(ctx, ai(h)))
+	assertError(t, time.Since(start) >= time.Millisecond*100, "the connection must be delayed")
+
+	n.SetLoss(1)
+	checkError(t, WaitFor(ctx, func() bool {
+		return hs[0].Network().Connectedness(hs[2].ID()) != network.Connected
+	}))
+	n.SetLoss(0)
+	checkError(t, hs[0].Connect(ctx, ai(hs[2])))
+}
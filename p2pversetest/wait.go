@@ -0,0 +1,138 @@
+package p2pversetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	query "github.com/ipfs/go-datastore/query"
+	host "github.com/libp2p/go-libp2p-core/host"
+	network "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+//the interval of the polling of the Wait functions
+var PollInterval = time.Millisecond * 50
+
+//WaitNoError calls f until it returns nil.
+//The last error of f is returned if ctx is done before.
+func WaitNoError(ctx context.Context, f func() error) error {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
+//WaitFor calls cond until it returns true.
+func WaitFor(ctx context.Context, cond func() bool) error {
+	return WaitNoError(ctx, func() error {
+		if cond() {
+			return nil
+		}
+		return errors.New("the condition is not satisfied")
+	})
+}
+
+//WaitConnected waits until h is connected to all of pids.
+func WaitConnected(ctx context.Context, h host.Host, pids ...peer.ID) error {
+	return WaitNoError(ctx, func() error {
+		for _, pid := range pids {
+			if h.Network().Connectedness(pid) != network.Connected {
+				return fmt.Errorf("%s is not connected to %s", h.ID(), pid)
+			}
+		}
+		return nil
+	})
+}
+
+//Getter is satisfied by the crdt stores.
+type Getter interface {
+	Get(string) ([]byte, error)
+}
+
+//WaitGet waits until the value of key is available from st.
+func WaitGet(ctx context.Context, st Getter, key string) ([]byte, error) {
+	var val []byte
+	err := WaitNoError(ctx, func() error {
+		v, err := st.Get(key)
+		if err != nil {
+			return err
+		}
+		val = v
+		return nil
+	})
+	return val, err
+}
+
+//Querier is satisfied by the crdt stores.
+type Querier interface {
+	Query(...query.Query) (query.Results, error)
+}
+
+//Snapshot returns the key-value pairs returned by st.Query(qs...).
+func Snapshot(st Querier, qs ...query.Query) (map[string][]byte, error) {
+	rs, err := st.Query(qs...)
+	if err != nil {
+		return nil, err
+	}
+	ress, err := rs.Rest()
+	if err != nil {
+		return nil, err
+	}
+	kvs := make(map[string][]byte, len(ress))
+	for _, res := range ress {
+		kvs[res.Key] = res.Value
+	}
+	return kvs, nil
+}
+
+//WaitConverged waits until the Query results of all the stores are the same.
+//qs are used for every store.
+func WaitConverged(ctx context.Context, stores []Querier, qs ...query.Query) error {
+	if len(stores) == 0 {
+		return errors.New("no stores are given")
+	}
+	return WaitNoError(ctx, func() error {
+		base, err := Snapshot(stores[0], qs...)
+		if err != nil {
+			return err
+		}
+		for idx, st := range stores[1:] {
+			kvs, err := Snapshot(st, qs...)
+			if err != nil {
+				return err
+			}
+			if err := compareSnapshots(base, kvs); err != nil {
+				return fmt.Errorf("store %d differs from store 0: %w", idx+1, err)
+			}
+		}
+		return nil
+	})
+}
+
+func compareSnapshots(a, b map[string][]byte) error {
+	if len(a) != len(b) {
+		return fmt.Errorf("%d records != %d records", len(b), len(a))
+	}
+	for k, v := range a {
+		v2, ok := b[k]
+		if !ok {
+			return fmt.Errorf("%s is missing", k)
+		}
+		if !bytes.Equal(v, v2) {
+			return fmt.Errorf("the value of %s is different", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package p2pverse
+
+import (
+	"context"
+
+	event "github.com/libp2p/go-libp2p-core/event"
+	host "github.com/libp2p/go-libp2p-core/host"
+	network "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+type PeerEventType int
+
+const (
+	PeerConnected PeerEventType = iota
+	PeerDisconnected
+	PeerIdentified
+)
+
+func (t PeerEventType) String() string {
+	switch t {
+	case PeerConnected:
+		return "connected"
+	case PeerDisconnected:
+		return "disconnected"
+	case PeerIdentified:
+		return "identified"
+	default:
+		return "unknown"
+	}
+}
+
+//Addrs are the remote addrs of the connections (empty if disconnected).
+//Protocols are set only if identified.
+type PeerEvent struct {
+	Type      PeerEventType
+	Peer      peer.ID
+	Addrs     []ma.Multiaddr
+	Protocols []string
+}
+
+const peerEventBufSize = 32
+
+//SubscribePeerEvents streams the connectivity events of h until ctx is done.
+//Events are dropped while the channel is full so that a slow reader never blocks the host.
+func SubscribePeerEvents(ctx context.Context, h host.Host) (<-chan PeerEvent, error) {
+	return subscribePeerEvents(ctx, context.Background(), h)
+}
+
+//the subscription ends when either ctx or parent is done.
+func subscribePeerEvents(ctx, parent context.Context, h host.Host) (<-chan PeerEvent, error) {
+	sub, err := h.EventBus().Subscribe([]interface{}{
+		new(event.EvtPeerConnectednessChanged),
+		new(event.EvtPeerIdentificationCompleted),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan PeerEvent, peerEventBufSize)
+	go func() {
+		defer close(ch)
+		defer sub.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-parent.Done():
+				return
+			case e, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				pe, ok := toPeerEvent(h, e)
+				if !ok {
+					continue
+				}
+				select {
+				case ch <- pe:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func toPeerEvent(h host.Host, e interface{}) (PeerEvent, bool) {
+	switch evt := e.(type) {
+	case event.EvtPeerConnectednessChanged:
+		switch evt.Connectedness {
+		case network.Connected:
+			return PeerEvent{Type: PeerConnected, Peer: evt.Peer, Addrs: remoteAddrs(h, evt.Peer)}, true
+		case network.NotConnected:
+			return PeerEvent{Type: PeerDisconnected, Peer: evt.Peer}, true
+		}
+	case event.EvtPeerIdentificationCompleted:
+		protos, _ := h.Peerstore().GetProtocols(evt.Peer)
+		return PeerEvent{
+			Type:      PeerIdentified,
+			Peer:      evt.Peer,
+			Addrs:     remoteAddrs(h, evt.Peer),
+			Protocols: protos,
+		}, true
+	}
+	return PeerEvent{}, false
+}
+
+func remoteAddrs(h host.Host, pid peer.ID) []ma.Multiaddr {
+	conns := h.Network().ConnsToPeer(pid)
+	addrs := make([]ma.Multiaddr, 0, len(conns))
+	for _, conn := range conns {
+		addrs = append(addrs, conn.RemoteMultiaddr())
+	}
+	return addrs
+}
+
+//connectedPeers returns the peers connected to h at the moment with the remote addrs of the connections.
+func connectedPeers(h host.Host) []peer.AddrInfo {
+	pids := h.Network().Peers()
+	ais := make([]peer.AddrInfo, 0, len(pids))
+	for _, pid := range pids {
+		if addrs := remoteAddrs(h, pid); len(addrs) > 0 {
+			ais = append(ais, AddrInfo(pid, addrs...))
+		}
+	}
+	return ais
+}
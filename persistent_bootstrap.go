@@ -0,0 +1,299 @@
+package p2pverse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	badger "github.com/ipfs/go-ds-badger2"
+	p2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	network "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	peerstore "github.com/libp2p/go-libp2p-core/peerstore"
+	kad "github.com/libp2p/go-libp2p-kad-dht"
+	multierr "go.uber.org/multierr"
+
+	pb "github.com/pilinsin/p2p-verse/pb"
+	proto "google.golang.org/protobuf/proto"
+)
+
+var (
+	peersKey      = ds.NewKey("/peers")
+	routingKey    = ds.NewKey("/routing")
+	bootstrapsKey = ds.NewKey("/bootstraps")
+)
+
+const persistInterval = time.Minute
+
+//LoadOrCreateKey loads an Ed25519 private key from keyFile.
+//If keyFile does not exist, a new key is generated and saved to keyFile.
+func LoadOrCreateKey(keyFile string) (p2pcrypto.PrivKey, error) {
+	m, err := ioutil.ReadFile(keyFile)
+	if err == nil {
+		priv, err := p2pcrypto.UnmarshalPrivateKey(m)
+		if err != nil {
+			return nil, err
+		}
+		if priv.Type() != p2pcrypto.Ed25519 {
+			return nil, errors.New("the key file must have an Ed25519 key")
+		}
+		return priv, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	priv, _, err := p2pcrypto.GenerateEd25519Key(getSeed())
+	if err != nil {
+		return nil, err
+	}
+	m, err = p2pcrypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(keyFile, m, 0600); err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
+
+//HostFromKey creates a host whose identity is priv, e.g. a key loaded from a keystore.
+//hGen must derive an Ed25519 key from its seed like SampleHost and NewHostGenerator.
+func HostFromKey(hGen HostGenerator, priv p2pcrypto.PrivKey) (host.Host, error) {
+	raw, err := priv.Raw()
+	if err != nil {
+		return nil, err
+	}
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := hGen(bytes.NewReader(raw[:32]))
+	if err != nil {
+		return nil, err
+	}
+	if h.ID() != pid {
+		h.Close()
+		return nil, errors.New("the HostGenerator does not derive an Ed25519 key from the seed")
+	}
+	return h, nil
+}
+
+//bootstrapPersistence saves the peerstore, the routing table and the known bootstraps of a bootstrap.
+type bootstrapPersistence struct {
+	cancel func()
+	done   chan struct{}
+	mutex  sync.Mutex
+	h      host.Host
+	dht    *kad.IpfsDHT
+	dStore ds.Batching
+	others []peer.AddrInfo
+}
+
+func NewPersistentBootstrap(hGen HostGenerator, keyFile, dataDir string, others ...peer.AddrInfo) (IBootstrap, error) {
+	return NewPersistentBootstrapContext(context.Background(), hGen, keyFile, dataDir, others...)
+}
+
+//the bootstrap keeps the private key in keyFile,
+//and its peerstore, routing table and known bootstraps in dataDir.
+//The known bootstraps are rejoined on restart even if others is empty.
+func NewPersistentBootstrapContext(ctx context.Context, hGen HostGenerator, keyFile, dataDir string, others ...peer.AddrInfo) (IBootstrap, error) {
+	priv, err := LoadOrCreateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+	stOpts := badger.DefaultOptions
+	stOpts.InMemory = false
+	dStore, err := badger.NewDatastore(dataDir, &stOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := HostFromKey(hGen, priv)
+	if err != nil {
+		dStore.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	d, err := newKad(ctx, h)
+	if err != nil {
+		cancel()
+		h.Close()
+		dStore.Close()
+		return nil, err
+	}
+
+	pCtx, pCancel := context.WithCancel(ctx)
+	bp := &bootstrapPersistence{
+		cancel: pCancel,
+		done:   make(chan struct{}),
+		h:      h,
+		dht:    d,
+		dStore: dStore,
+	}
+	bp.loadPeers(ctx)
+	known := bp.loadAddrInfos(ctx, bootstrapsKey)
+	othersMap := AddrInfoSliceToMap(others)
+	for _, ai := range known {
+		if _, ok := othersMap[ai.ID]; !ok && ai.ID != h.ID() {
+			others = append(others, ai)
+		}
+	}
+	bp.others = others
+
+	//a restarted bootstrap may be the first one online, and the Reconnector retries the others.
+	if len(others) > 0 {
+		if err := connectBootstraps(ctx, h, others, DefaultLogger()); err != nil {
+			DefaultLogger().Warn("bootstrap started without the other bootstraps", F("error", err))
+		}
+	}
+
+	rc := NewReconnector(ctx, h)
+	rc.Add(others...)
+	go bp.run(pCtx)
+	return &bootstrap{ctx, cancel, h, d, rc, bp}, nil
+}
+
+func (bp *bootstrapPersistence) close() error {
+	bp.cancel()
+	<-bp.done
+	err := bp.save(context.Background())
+	return multierr.Append(err, bp.dStore.Close())
+}
+
+//the saved routing table is warmed up in the background and saved every persistInterval.
+func (bp *bootstrapPersistence) run(ctx context.Context) {
+	defer close(bp.done)
+	for _, ai := range bp.loadAddrInfos(ctx, routingKey) {
+		if ai.ID == bp.h.ID() || bp.h.Network().Connectedness(ai.ID) == network.Connected {
+			continue
+		}
+		cCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+		bp.h.Connect(cCtx, ai)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			bp.save(ctx)
+		}
+	}
+}
+
+func (bp *bootstrapPersistence) save(ctx context.Context) error {
+	bp.mutex.Lock()
+	defer bp.mutex.Unlock()
+
+	entries := make(map[ds.Key][]byte)
+	ps := bp.h.Peerstore()
+	for _, pid := range ps.PeersWithAddrs() {
+		if pid != bp.h.ID() {
+			addAddrInfo(entries, peersKey, ps.PeerInfo(pid))
+		}
+	}
+	for _, pid := range bp.dht.RoutingTable().ListPeers() {
+		addAddrInfo(entries, routingKey, ps.PeerInfo(pid))
+	}
+	for _, ai := range bp.others {
+		addAddrInfo(entries, bootstrapsKey, ai)
+	}
+
+	batch, err := bp.dStore.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range []ds.Key{peersKey, routingKey, bootstrapsKey} {
+		if err := bp.deleteStale(ctx, batch, prefix, entries); err != nil {
+			return err
+		}
+	}
+	for key, m := range entries {
+		if err := batch.Put(ctx, key, m); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
+func (bp *bootstrapPersistence) deleteStale(ctx context.Context, batch ds.Batch, prefix ds.Key, entries map[ds.Key][]byte) error {
+	rs, err := bp.dStore.Query(ctx, query.Query{Prefix: prefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer rs.Close()
+	for res := range rs.Next() {
+		if res.Error != nil {
+			return res.Error
+		}
+		key := ds.NewKey(res.Key)
+		if _, ok := entries[key]; ok {
+			continue
+		}
+		if err := batch.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func addAddrInfo(entries map[ds.Key][]byte, prefix ds.Key, ai peer.AddrInfo) {
+	if len(ai.Addrs) == 0 {
+		return
+	}
+	m, err := proto.Marshal(peerToPb(ai))
+	if err != nil {
+		return
+	}
+	entries[prefix.ChildString(ai.ID.String())] = m
+}
+
+func (bp *bootstrapPersistence) loadAddrInfos(ctx context.Context, prefix ds.Key) []peer.AddrInfo {
+	rs, err := bp.dStore.Query(ctx, query.Query{Prefix: prefix.String()})
+	if err != nil {
+		return nil
+	}
+	defer rs.Close()
+
+	ais := make([]peer.AddrInfo, 0)
+	for res := range rs.Next() {
+		if res.Error != nil {
+			continue
+		}
+		mai := &pb.AddrInfo{}
+		if err := proto.Unmarshal(res.Value, mai); err != nil {
+			continue
+		}
+		ai, err := pbToPeer(mai)
+		if err != nil {
+			continue
+		}
+		ais = append(ais, ai)
+	}
+	return ais
+}
+func (bp *bootstrapPersistence) loadPeers(ctx context.Context) {
+	for _, ai := range bp.loadAddrInfos(ctx, peersKey) {
+		bp.h.Peerstore().AddAddrs(ai.ID, ai.Addrs, peerstore.AddressTTL)
+	}
+}
@@ -4,13 +4,15 @@ import (
 	"context"
 	"errors"
 	"sort"
+	"sync"
 	"time"
 
-	host "github.com/libp2p/go-libp2p-core/host"
+	ipfslt "github.com/hsanjuan/ipfs-lite"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	p2ppubsub "github.com/libp2p/go-libp2p-pubsub"
 	pv "github.com/pilinsin/p2p-verse"
 	pb "github.com/pilinsin/p2p-verse/pubsub/pb"
+	multierr "go.uber.org/multierr"
 	proto "google.golang.org/protobuf/proto"
 )
 
@@ -21,57 +23,96 @@ import (
 const pubsubKeyword = "pubsub:ejvoaenvaeo;vn;aeo"
 
 type IPubSub interface {
-	Close()
+	Close() error
 	AddrInfo() peer.AddrInfo
 	Topics() []string
 	JoinTopic(string) (IRoom, error)
 }
 type pubSub struct {
-	hGen pv.HostGenerator
-	bs   []peer.AddrInfo
-	h    host.Host
-	dht  *pv.DiscoveryDHT
-	ps   *p2ppubsub.PubSub
+	hGen    pv.HostGenerator
+	discs   []pv.DiscovererGenerator
+	bs      []peer.AddrInfo
+	node    *pv.Node
+	ownNode bool
+	ps      *p2ppubsub.PubSub
+	mutex   sync.Mutex
+	rooms   map[*room]struct{}
 }
 
 func NewPubSub(hGen pv.HostGenerator, bootstraps ...peer.AddrInfo) (IPubSub, error) {
-	self, err := hGen()
+	return NewPubSubWithDiscoverers(hGen, nil, bootstraps...)
+}
+
+//the GossipSub router also finds the peers of a topic with discs, e.g. pv.MdnsGenerator.
+func NewPubSubWithDiscoverers(hGen pv.HostGenerator, discs []pv.DiscovererGenerator, bootstraps ...peer.AddrInfo) (IPubSub, error) {
+	node, err := pv.NewNodeWithDatastore(hGen, ipfslt.NewInMemoryDatastore(), bootstraps...)
 	if err != nil {
 		return nil, err
 	}
-	dht, err := pv.NewDHT(self)
-	if err != nil {
+	if err := node.AddDiscoverers(discs...); err != nil {
+		node.Close()
 		return nil, err
 	}
 
-	ctx := context.Background()
-	withDiscovery := p2ppubsub.WithDiscovery(dht.Discovery())
-	gossip, err := p2ppubsub.NewGossipSub(ctx, self, withDiscovery)
+	ps, err := newPubSub(hGen, node, true, discs...)
 	if err != nil {
+		node.Close()
 		return nil, err
 	}
+	return ps, nil
+}
 
-	if err := dht.Bootstrap(pubsubKeyword, bootstraps); err != nil {
+//rooms joined from the returned IPubSub use the GossipSub router of node.
+func NewPubSubFromNode(node *pv.Node) (IPubSub, error) {
+	return newPubSub(nil, node, false)
+}
+func newPubSub(hGen pv.HostGenerator, node *pv.Node, ownNode bool, discs ...pv.DiscovererGenerator) (*pubSub, error) {
+	bootstraps := node.Bootstraps()
+	if err := node.DHT().Bootstrap(pubsubKeyword, bootstraps); err != nil {
 		return nil, err
 	}
-	return &pubSub{hGen, bootstraps, self, dht, gossip}, nil
+	return &pubSub{
+		hGen:    hGen,
+		discs:   discs,
+		bs:      bootstraps,
+		node:    node,
+		ownNode: ownNode,
+		ps:      node.PubSub(),
+		rooms:   make(map[*room]struct{}),
+	}, nil
 }
-func (ps *pubSub) Close() {
-	ps.ps = nil
-	ps.dht.Close()
-	ps.h.Close()
+
+//Close leaves the joined rooms, and then closes the node with its GossipSub router if it is owned.
+func (ps *pubSub) Close() error {
+	ps.mutex.Lock()
+	rooms := make([]*room, 0, len(ps.rooms))
+	for r := range ps.rooms {
+		rooms = append(rooms, r)
+	}
+	ps.mutex.Unlock()
+
+	var err error
+	for _, r := range rooms {
+		err = multierr.Append(err, r.Close())
+	}
+	if ps.ownNode {
+		err = multierr.Append(err, ps.node.Close())
+	}
+	return err
 }
 func (ps *pubSub) AddrInfo() peer.AddrInfo {
-	return pv.HostToAddrInfo(ps.h)
+	return ps.node.AddrInfo()
 }
 func (ps *pubSub) Topics() []string {
 	return ps.ps.GetTopics()
 }
 
 type IRoom interface {
-	Close()
+	Close() error
 	ListPeers() []peer.ID
 	Publish([]byte) error
+	PublishContext(context.Context, []byte) error
+	Next(context.Context) (*recievedMessage, error)
 	Get() (*recievedMessage, error)
 	GetAll() ([]*recievedMessage, error)
 }
@@ -91,36 +132,47 @@ func (ps *pubSub) JoinTopic(topicName string) (IRoom, error) {
 	}
 	sub, err := topic.Subscribe()
 	if err != nil {
+		topic.Close()
 		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
-	return &room{ctx, cancel, ps, topicName, topic, sub}, nil
+	r := &room{ctx, cancel, ps, topicName, topic, sub}
+	ps.mutex.Lock()
+	ps.rooms[r] = struct{}{}
+	ps.mutex.Unlock()
+	return r, nil
 }
-func (r *room) reset() error {
+func (r *room) reset(ctx context.Context) error {
 	N := 50
 	for i := 0; i < N; i++ {
 		if len(r.ListPeers()) > 0 {
 			return nil
 		}
-		if err := r.baseReset(); err != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := r.baseReset(ctx); err != nil {
 			return err
 		}
 	}
 	return errors.New("connection reset timeout")
 }
-func (r *room) baseReset() error {
-	r.cancel()
-	r.sub.Cancel()
-	r.topic.Close()
+func (r *room) baseReset(ctx context.Context) error {
+	if !r.ps.ownNode {
+		//the shared router can not be recreated, so only rediscover peers
+		return r.ps.node.DHT().BootstrapContext(ctx, pubsubKeyword, r.ps.bs)
+	}
+
 	r.ps.Close()
 
-	ps, err := NewPubSub(r.ps.hGen, r.ps.bs...)
+	ps, err := NewPubSubWithDiscoverers(r.ps.hGen, r.ps.discs, r.ps.bs...)
 	if err != nil {
 		return err
 	}
 	r2, err := ps.JoinTopic(r.topicName)
 	if err != nil {
+		ps.Close()
 		return err
 	}
 	room2 := r2.(*room)
@@ -131,18 +183,39 @@ func (r *room) baseReset() error {
 	r.topicName = room2.topicName
 	r.topic = room2.topic
 	r.sub = room2.sub
+	//r takes the place of room2 in the new pubSub
+	r.ps.mutex.Lock()
+	delete(r.ps.rooms, room2)
+	r.ps.rooms[r] = struct{}{}
+	r.ps.mutex.Unlock()
 	return nil
 }
-func (r *room) Close() {
+
+//Close leaves the topic. The pubSub of the room is not closed.
+func (r *room) Close() error {
+	r.ps.mutex.Lock()
+	delete(r.ps.rooms, r)
+	r.ps.mutex.Unlock()
+
 	r.cancel()
 	r.sub.Cancel()
-	r.topic.Close()
-	r.ps = nil
+	//the subscription is removed asynchronously
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = r.topic.Close(); err == nil {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return err
 }
 func (r *room) ListPeers() []peer.ID {
 	return r.topic.ListPeers()
 }
 func (r *room) Publish(data []byte) error {
+	return r.PublishContext(r.ctx, data)
+}
+func (r *room) PublishContext(ctx context.Context, data []byte) error {
 	t, _ := time.Now().UTC().MarshalBinary()
 	mes := &pb.Message{
 		Data: data,
@@ -153,12 +226,16 @@ func (r *room) Publish(data []byte) error {
 		return err
 	}
 
-	if err := r.reset(); err != nil {
+	if err := r.reset(ctx); err != nil {
 		return err
 	}
 
 	ready := p2ppubsub.WithReadiness(p2ppubsub.MinTopicSize(1))
-	return r.topic.Publish(r.ctx, mm, ready)
+	if err := r.topic.Publish(ctx, mm, ready); err != nil {
+		return err
+	}
+	pv.DefaultMetrics().Inc("p2pverse_pubsub_messages_published_total", "room", r.topicName)
+	return nil
 }
 
 type recievedMessage struct {
@@ -166,6 +243,16 @@ type recievedMessage struct {
 	Time time.Time
 }
 
+//the received messages are counted by room, and the malformed ones as dropped.
+func (r *room) convertMessage(mes *p2ppubsub.Message) (*recievedMessage, error) {
+	rMes, err := convertMessage(mes)
+	if err != nil {
+		pv.DefaultMetrics().Inc("p2pverse_pubsub_messages_dropped_total", "room", r.topicName)
+		return nil, err
+	}
+	pv.DefaultMetrics().Inc("p2pverse_pubsub_messages_received_total", "room", r.topicName)
+	return rMes, nil
+}
 func convertMessage(mes *p2ppubsub.Message) (*recievedMessage, error) {
 	rawMes := &pb.Message{}
 	if err := proto.Unmarshal(mes.GetData(), rawMes); err != nil {
@@ -179,8 +266,21 @@ func convertMessage(mes *p2ppubsub.Message) (*recievedMessage, error) {
 	rMes.Data = rawMes.GetData()
 	return rMes, nil
 }
+
+//Next blocks until a message is received or ctx is done.
+func (r *room) Next(ctx context.Context) (*recievedMessage, error) {
+	if err := r.reset(ctx); err != nil {
+		return nil, err
+	}
+
+	mes, err := r.sub.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.convertMessage(mes)
+}
 func (r *room) Get() (*recievedMessage, error) {
-	if err := r.reset(); err != nil {
+	if err := r.reset(r.ctx); err != nil {
 		return nil, err
 	}
 
@@ -197,7 +297,7 @@ func (r *room) Get() (*recievedMessage, error) {
 		}
 	}
 
-	return convertMessage(mes)
+	return r.convertMessage(mes)
 }
 func (r *room) GetAll() ([]*recievedMessage, error) {
 	mess := make([]*recievedMessage, 0)
@@ -217,7 +317,7 @@ func (r *room) GetAll() ([]*recievedMessage, error) {
 				return nil, err
 			}
 		}
-		if rMes, err := convertMessage(mes); err == nil {
+		if rMes, err := r.convertMessage(mes); err == nil {
 			mess = append(mess, rMes)
 		}
 	}
@@ -2,9 +2,12 @@ package pubsub
 
 import (
 	"testing"
-	pv "github.com/pilinsin/p2p-verse"
+
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
 )
 
 func TestPubSub(t *testing.T) {
-	BaseTestPubSub(t, pv.SampleHost)
+	n := p2pversetest.NewNetwork()
+	defer n.Close()
+	BaseTestPubSub(t, n.HostGenerator())
 }
@@ -1,12 +1,14 @@
 package pubsub
 
 import (
+	"context"
 	"testing"
 
 	"fmt"
 	"time"
 
 	pv "github.com/pilinsin/p2p-verse"
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
 )
 
 func checkError(t *testing.T, err error, args ...interface{}) {
@@ -27,17 +29,23 @@ func BaseTestPubSub(t *testing.T, hGen pv.HostGenerator) {
 	bAddrInfo := bstrp.AddrInfo()
 	t.Log("bootstrap AddrInfo: ", bAddrInfo)
 
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
 	N := 10
 	ps0, err01 := NewPubSub(hGen, bAddrInfo)
 	checkError(t, err01)
 	tpc0, err02 := ps0.JoinTopic("test topic")
 	checkError(t, err02)
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		defer tpc0.Close()
 		defer ps0.Close()
 		itr := 0
-		for {
+		for ctx.Err() == nil {
 			if len(tpc0.ListPeers()) == 0 {
+				time.Sleep(p2pversetest.PollInterval)
 				continue
 			}
 
@@ -62,7 +70,8 @@ func BaseTestPubSub(t *testing.T, hGen pv.HostGenerator) {
 	checkError(t, err12)
 	defer tpc1.Close()
 	defer ps1.Close()
-	time.Sleep(time.Second * 2)
+	err = p2pversetest.WaitFor(ctx, func() bool { return len(tpc1.ListPeers()) > 0 })
+	checkError(t, err, "no topic peers")
 
 	t.Log("topic peers list  :", tpc1.ListPeers())
 	for i := 0; i < N; i++ {
@@ -70,6 +79,10 @@ func BaseTestPubSub(t *testing.T, hGen pv.HostGenerator) {
 		checkError(t, err)
 	}
 
-	time.Sleep(time.Second * 10)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for the messages")
+	}
 	t.Log("finished")
 }
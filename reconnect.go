@@ -0,0 +1,254 @@
+package p2pverse
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	network "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+type ReconnectOpts struct {
+	//the backoff after the first failed attempt (default: 1s)
+	MinBackoff time.Duration
+	//the upper limit of the backoff, which is doubled every failed attempt (default: 5m)
+	MaxBackoff time.Duration
+	//the backoff is randomized by ±Jitter*backoff (default: 0.2)
+	Jitter float64
+	//the timeout of a connection attempt (default: 10s)
+	DialTimeout time.Duration
+}
+
+func getReconnectOpts(opts ...*ReconnectOpts) *ReconnectOpts {
+	opt := &ReconnectOpts{}
+	if len(opts) > 0 && opts[0] != nil {
+		*opt = *opts[0]
+	}
+	if opt.MinBackoff <= 0 {
+		opt.MinBackoff = time.Second
+	}
+	if opt.MaxBackoff < opt.MinBackoff {
+		opt.MaxBackoff = time.Minute * 5
+		if opt.MaxBackoff < opt.MinBackoff {
+			opt.MaxBackoff = opt.MinBackoff
+		}
+	}
+	if opt.Jitter <= 0 || opt.Jitter > 1 {
+		opt.Jitter = 0.2
+	}
+	if opt.DialTimeout <= 0 {
+		opt.DialTimeout = time.Second * 10
+	}
+	return opt
+}
+
+//Connected is true if Attempt succeeded.
+//Err and Backoff are the failure of Attempt and the wait before the next attempt.
+type ReconnectEvent struct {
+	Peer      peer.ID
+	Attempt   int
+	Connected bool
+	Err       error
+	Backoff   time.Duration
+}
+
+type supervisedPeer struct {
+	ai      peer.AddrInfo
+	cancel  func()
+	trigger chan struct{}
+}
+
+//Reconnector keeps the connections to the supervised peers, e.g. bootstraps.
+//A disconnected peer is redialed with exponential backoff and jitter until it is removed.
+type Reconnector struct {
+	ctx    context.Context
+	cancel func()
+	h      host.Host
+	opt    *ReconnectOpts
+	nb     network.Notifiee
+	wg     sync.WaitGroup
+	mutex  sync.Mutex
+	peers  map[peer.ID]*supervisedPeer
+	subs   map[chan ReconnectEvent]struct{}
+}
+
+//the Reconnector runs until ctx is done or Close is called.
+func NewReconnector(ctx context.Context, h host.Host, opts ...*ReconnectOpts) *Reconnector {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &Reconnector{
+		ctx:    ctx,
+		cancel: cancel,
+		h:      h,
+		opt:    getReconnectOpts(opts...),
+		peers:  make(map[peer.ID]*supervisedPeer),
+		subs:   make(map[chan ReconnectEvent]struct{}),
+	}
+	r.nb = &network.NotifyBundle{
+		DisconnectedF: func(_ network.Network, conn network.Conn) {
+			r.peerDisconnected(conn.RemotePeer())
+		},
+	}
+	h.Network().Notify(r.nb)
+	return r
+}
+func (r *Reconnector) Close() {
+	r.h.Network().StopNotify(r.nb)
+	r.cancel()
+	r.wg.Wait()
+}
+
+//Add starts supervising ais.
+//The addrs of an already supervised peer are replaced.
+func (r *Reconnector) Add(ais ...peer.AddrInfo) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.ctx.Err() != nil {
+		return
+	}
+	for _, ai := range ais {
+		if ai.ID == "" || ai.ID == r.h.ID() {
+			continue
+		}
+		if sp, ok := r.peers[ai.ID]; ok {
+			sp.ai = ai
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(r.ctx)
+		sp := &supervisedPeer{ai, cancel, make(chan struct{}, 1)}
+		r.peers[ai.ID] = sp
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.supervise(ctx, sp)
+		}()
+	}
+}
+
+//Remove stops supervising pid without closing the connection.
+func (r *Reconnector) Remove(pid peer.ID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if sp, ok := r.peers[pid]; ok {
+		sp.cancel()
+		delete(r.peers, pid)
+	}
+}
+
+//Peers returns the supervised peers.
+func (r *Reconnector) Peers() []peer.AddrInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ais := make([]peer.AddrInfo, 0, len(r.peers))
+	for _, sp := range r.peers {
+		ais = append(ais, sp.ai)
+	}
+	return ais
+}
+
+//Subscribe returns the reconnection attempts until ctx is done or the Reconnector is closed.
+func (r *Reconnector) Subscribe(ctx context.Context) <-chan ReconnectEvent {
+	ch := make(chan ReconnectEvent, 32)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.ctx.Err() != nil {
+		close(ch)
+		return ch
+	}
+	r.subs[ch] = struct{}{}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		select {
+		case <-ctx.Done():
+		case <-r.ctx.Done():
+		}
+		r.mutex.Lock()
+		delete(r.subs, ch)
+		r.mutex.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+//events are dropped for a subscriber whose channel is full.
+func (r *Reconnector) emit(ev ReconnectEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for ch := range r.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (r *Reconnector) peerDisconnected(pid peer.ID) {
+	r.mutex.Lock()
+	sp, ok := r.peers[pid]
+	r.mutex.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case sp.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Reconnector) addrInfo(sp *supervisedPeer) peer.AddrInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return sp.ai
+}
+
+func (r *Reconnector) supervise(ctx context.Context, sp *supervisedPeer) {
+	attempt := 0
+	for {
+		if r.h.Network().Connectedness(sp.ai.ID) == network.Connected {
+			attempt = 0
+			select {
+			case <-ctx.Done():
+				return
+			case <-sp.trigger:
+				continue
+			}
+		}
+
+		attempt++
+		cCtx, cancel := context.WithTimeout(ctx, r.opt.DialTimeout)
+		err := r.h.Connect(cCtx, r.addrInfo(sp))
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			r.emit(ReconnectEvent{Peer: sp.ai.ID, Attempt: attempt, Connected: true})
+			continue
+		}
+
+		backoff := r.backoff(attempt)
+		r.emit(ReconnectEvent{Peer: sp.ai.ID, Attempt: attempt, Err: err, Backoff: backoff})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (r *Reconnector) backoff(attempt int) time.Duration {
+	backoff := r.opt.MinBackoff
+	for i := 1; i < attempt && backoff < r.opt.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.opt.MaxBackoff {
+		backoff = r.opt.MaxBackoff
+	}
+	jitter := (rand.Float64()*2 - 1) * r.opt.Jitter * float64(backoff)
+	return backoff + time.Duration(jitter)
+}
@@ -1,14 +1,29 @@
 package test
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	ipfslt "github.com/hsanjuan/ipfs-lite"
+	host "github.com/libp2p/go-libp2p-core/host"
+	network "github.com/libp2p/go-libp2p-core/network"
 	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
 
 	pv "github.com/pilinsin/p2p-verse"
 	crdt "github.com/pilinsin/p2p-verse/crdt"
 	ipfs "github.com/pilinsin/p2p-verse/ipfs"
+	p2pversetest "github.com/pilinsin/p2p-verse/p2pversetest"
+	pb "github.com/pilinsin/p2p-verse/pb"
 	pubsub "github.com/pilinsin/p2p-verse/pubsub"
+	proto "google.golang.org/protobuf/proto"
 )
 
 func checkError(t *testing.T, err error, args ...interface{}) {
@@ -71,10 +86,583 @@ func testBootstrap(t *testing.T) {
 	t.Log("finished")
 }
 
+func testDiscovery(t *testing.T) {
+	b, err := pv.NewBootstrap(pv.SampleHost)
+	checkError(t, err)
+	defer b.Close()
+	bAddrs := []peer.AddrInfo{b.AddrInfo()}
+
+	dhts := make([]*pv.DiscoveryDHT, 2)
+	for idx := range dhts {
+		h, err := pv.SampleHost()
+		checkError(t, err)
+		defer h.Close()
+		d, err := pv.NewDHT(h)
+		checkError(t, err)
+		defer d.Close()
+		dhts[idx] = d
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	evCh := dhts[0].SubscribeDiscovery(ctx)
+
+	keyword := "discovery test keyword"
+	opts := &pv.DiscoveryOpts{Low: 1, Interval: time.Second}
+	for _, d := range dhts {
+		checkError(t, d.BootstrapContext(ctx, keyword, bAddrs))
+		d.StartDiscovery(keyword, opts)
+	}
+
+	other := dhts[1].DHT().Host().ID()
+	for ev := range evCh {
+		t.Log("discovery event:", ev)
+		if ev.Keyword == keyword && ev.Peer == other && ev.Connected {
+			return
+		}
+	}
+	t.Fatal("the other peer must be discovered")
+}
+
+func testConcurrentDiscovery(t *testing.T) {
+	h, err := pv.SampleHost()
+	checkError(t, err)
+	defer h.Close()
+	d, err := pv.NewDHT(h)
+	checkError(t, err)
+	defer d.Close()
+
+	lc := p2pversetest.NewLeakChecker("github.com/pilinsin/p2p-verse.(*DiscoveryDHT).advertise", "github.com/pilinsin/p2p-verse.(*DiscoveryDHT).keepPeers")
+	keyword := "concurrent discovery test keyword"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.StartDiscovery(keyword, &pv.DiscoveryOpts{Interval: time.Second})
+		}()
+	}
+	wg.Wait()
+	d.StopDiscovery(keyword)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	checkError(t, lc.Wait(ctx), "the replaced discoveries must be stopped")
+}
+
+func testStaticDiscovery(t *testing.T) {
+	hs := make([]host.Host, 2)
+	for idx := range hs {
+		h, err := pv.SampleHost()
+		checkError(t, err)
+		defer h.Close()
+		hs[idx] = h
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	//no bootstrap is required
+	keyword := "static discovery test keyword"
+	dhts := make([]*pv.DiscoveryDHT, 2)
+	for idx, h := range hs {
+		other := pv.HostToAddrInfo(hs[1-idx])
+		d, err := pv.NewDHT(h, pv.NewStaticDiscoverer(other))
+		checkError(t, err)
+		defer d.Close()
+		dhts[idx] = d
+	}
+	evCh := dhts[0].SubscribeDiscovery(ctx)
+	checkError(t, dhts[0].BootstrapContext(ctx, keyword, nil))
+	checkError(t, dhts[1].BootstrapContext(ctx, "other keyword", nil))
+
+	assertError(t, hs[0].Network().Connectedness(hs[1].ID()) == network.Connected, "the static peer must be connected")
+	//the static peer does not advertise keyword, so it is not a peer of keyword
+	dhts[0].StartDiscovery(keyword, &pv.DiscoveryOpts{Low: 1, Interval: time.Second})
+	time.Sleep(time.Second * 3)
+	assertError(t, len(dhts[0].KeywordPeers(keyword)) == 0, "the static peer must not be counted as a peer of the keyword")
+	select {
+	case ev := <-evCh:
+		t.Fatal("the static peer must not be discovered:", ev)
+	default:
+	}
+	assertError(t, hs[0].Network().Connectedness(hs[1].ID()) == network.Connected, "the static peer must stay connected")
+}
+
+func testHostGenerator(t *testing.T) {
+	hGen := pv.NewHostGenerator(&pv.HostOpts{
+		ListenAddrs:  []string{"/ip4/127.0.0.1/tcp/0"},
+		Transports:   []pv.Transport{pv.TCP},
+		ConnLow:      2,
+		ConnHigh:     4,
+		MaxConns:     64,
+		Reachability: pv.ReachabilityPrivate,
+		DisableRelay: true,
+	})
+
+	hs := make([]host.Host, 2)
+	for idx := range hs {
+		h, err := hGen()
+		checkError(t, err)
+		defer h.Close()
+		hs[idx] = h
+		for _, addr := range h.Addrs() {
+			_, err := addr.ValueForProtocol(ma.P_TCP)
+			checkError(t, err, "only tcp must be listened:", addr)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	checkError(t, hs[0].Connect(ctx, pv.HostToAddrInfo(hs[1])))
+	assertError(t, hs[1].Network().Connectedness(hs[0].ID()) == network.Connected, "hosts must be connected")
+
+	_, err := pv.NewHostGenerator(&pv.HostOpts{Transports: []pv.Transport{"unknown"}})()
+	assertError(t, err != nil, "an unknown transport must be rejected")
+}
+
+func testPrivateNetwork(t *testing.T) {
+	psk, err := pv.NewPSK()
+	checkError(t, err)
+	hGen := pv.NewHostGenerator(&pv.HostOpts{
+		ListenAddrs:  []string{"/ip4/127.0.0.1/tcp/0"},
+		Reachability: pv.ReachabilityPublic,
+		PSK:          psk,
+	})
+
+	b, err := pv.NewBootstrap(hGen)
+	checkError(t, err)
+	defer b.Close()
+	bAddrs := []peer.AddrInfo{b.AddrInfo()}
+
+	h, err := hGen()
+	checkError(t, err)
+	defer h.Close()
+	d, err := pv.NewDHT(h)
+	checkError(t, err)
+	defer d.Close()
+	checkError(t, d.Bootstrap("private network test keyword", bAddrs))
+
+	privateKad := false
+	for _, pid := range h.Mux().Protocols() {
+		assertError(t, pid != "/ipfs/kad/1.0.0", "the public DHT protocol must not be used")
+		privateKad = privateKad || pid == "/p2p-verse/kad/1.0.0"
+	}
+	assertError(t, privateKad, "the private DHT protocol must be used")
+
+	pub, err := pv.SampleHost()
+	checkError(t, err)
+	defer pub.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	err = pub.Connect(ctx, b.AddrInfo())
+	assertError(t, err != nil, "a host without the PSK must not connect to the private network")
+}
+
+func testGater(t *testing.T) {
+	g := pv.NewGater(&pv.GaterOpts{MaxOffenses: 2, BanPeriod: time.Minute})
+	hGen := pv.NewHostGenerator(&pv.HostOpts{
+		ListenAddrs:  []string{"/ip4/127.0.0.1/tcp/0"},
+		Reachability: pv.ReachabilityPublic,
+		Gater:        g,
+	})
+	b, err := pv.NewBootstrap(pv.SampleHost)
+	checkError(t, err)
+	defer b.Close()
+	bAddrs := []peer.AddrInfo{b.AddrInfo()}
+
+	node, err := pv.NewNodeWithDatastore(hGen, ipfslt.NewInMemoryDatastore(), bAddrs...)
+	checkError(t, err)
+	defer node.Close()
+	assertError(t, node.Gater() == g, "the node must use the gater of the host")
+
+	//deny list
+	denied, err := pv.SampleHost()
+	checkError(t, err)
+	defer denied.Close()
+	g.Deny(denied.ID())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = denied.Connect(ctx, node.AddrInfo())
+	assertError(t, err != nil || node.Host().Network().Connectedness(denied.ID()) != network.Connected, "a denied peer must not connect")
+	g.Remove(denied.ID())
+
+	//a peer broadcasting invalid deltas is banned
+	stName := "gater test store"
+	defer os.RemoveAll("gater")
+	cv := crdt.NewVerseFromNode(node, "gater", false)
+	st, err := cv.NewStore(stName, "log")
+	checkError(t, err)
+	defer st.Close()
+
+	attacker, err := pv.NewNodeWithDatastore(pv.SampleHost, ipfslt.NewInMemoryDatastore(), bAddrs...)
+	checkError(t, err)
+	defer attacker.Close()
+	checkError(t, attacker.Host().Connect(ctx, node.AddrInfo()))
+	topic, err := attacker.PubSub().Join(stName)
+	checkError(t, err)
+	defer topic.Close()
+
+	for len(g.Bans()) == 0 {
+		if len(topic.ListPeers()) > 0 {
+			//a crdt broadcast without heads
+			checkError(t, topic.Publish(ctx, []byte{}))
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("the attacker must be banned")
+		case <-time.After(time.Second):
+		}
+	}
+	bans := g.Bans()
+	t.Log("bans:", bans)
+	assertError(t, bans[0].Peer == attacker.Host().ID(), "the attacker must be banned")
+	assertError(t, pv.DefaultMetrics().Value("p2pverse_store_validator_rejections_total", "store", stName, "reason", "malformed") > 0, "the rejections must be counted")
+	assertError(t, g.IsBlocked(attacker.Host().ID()), "the attacker must be blocked")
+	time.Sleep(time.Second)
+	assertError(t, node.Host().Network().Connectedness(attacker.Host().ID()) != network.Connected, "the attacker must be disconnected")
+
+	g.Unban(attacker.Host().ID())
+	assertError(t, !g.IsBlocked(attacker.Host().ID()), "the attacker must be unbanned")
+
+	//the offenses expire after the OffensePeriod
+	eg := pv.NewGater(&pv.GaterOpts{MaxOffenses: 2, OffensePeriod: time.Second})
+	assertError(t, !eg.Report(denied.ID(), "test"), "the first offense must not ban")
+	time.Sleep(time.Second * 2)
+	assertError(t, eg.Offenses(denied.ID()) == 0, "the offense must expire")
+	assertError(t, !eg.Report(denied.ID(), "test"), "the expired offense must not be counted")
+	assertError(t, eg.Report(denied.ID(), "test"), "the offenses within the OffensePeriod must ban")
+}
+
+func testPersistentBootstrap(t *testing.T) {
+	defer os.RemoveAll("pb")
+	other, err := pv.NewBootstrap(pv.SampleHost)
+	checkError(t, err)
+	defer other.Close()
+
+	b, err := pv.NewPersistentBootstrap(pv.SampleHost, "pb/key", "pb/data", other.AddrInfo())
+	checkError(t, err)
+	pid := b.AddrInfo().ID
+	assertError(t, len(b.ConnectedPeers()) == 1, "failed to connect to the other bootstrap")
+
+	h, err := pv.SampleHost()
+	checkError(t, err)
+	defer h.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	checkError(t, h.Connect(ctx, b.AddrInfo()))
+	b.Close()
+
+	//the key is also usable by NewHostGenerator, and the other bootstrap is rejoined
+	hGen := pv.NewHostGenerator(&pv.HostOpts{Reachability: pv.ReachabilityPublic})
+	b, err = pv.NewPersistentBootstrap(hGen, "pb/key", "pb/data")
+	checkError(t, err)
+	defer b.Close()
+	assertError(t, b.AddrInfo().ID == pid, "the peer ID must be kept")
+	assertError(t, len(b.ConnectedPeers()) == 1, "the other bootstrap must be rejoined")
+	assertError(t, b.ConnectedPeers()[0].ID == other.AddrInfo().ID, "the other bootstrap must be rejoined")
+	assertError(t, pv.AddrInfoToString(b.AddrInfo()) != "", "invalid AddrInfo")
+}
+
+func waitPeerEvent(t *testing.T, ch <-chan pv.PeerEvent, typ pv.PeerEventType, pid peer.ID) pv.PeerEvent {
+	timeout := time.After(time.Second * 10)
+	for {
+		select {
+		case e, ok := <-ch:
+			assertError(t, ok, "the event channel is closed")
+			if e.Type == typ && e.Peer == pid {
+				return e
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for", typ, "event")
+		}
+	}
+}
+func testPeerEvents(t *testing.T) {
+	b, err := pv.NewBootstrap(pv.SampleHost)
+	checkError(t, err)
+	defer b.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := b.SubscribePeerEvents(ctx)
+	checkError(t, err)
+	assertError(t, len(b.ConnectedPeers()) == 0, "no peer must be connected")
+
+	h, err := pv.SampleHost()
+	checkError(t, err)
+	d, err := pv.NewDHT(h)
+	checkError(t, err)
+	defer d.Close()
+	dch, err := d.SubscribePeerEvents(ctx)
+	checkError(t, err)
+	checkError(t, h.Connect(ctx, b.AddrInfo()))
+
+	e := waitPeerEvent(t, ch, pv.PeerConnected, h.ID())
+	assertError(t, len(e.Addrs) > 0, "the connected event must have the remote addrs")
+	e = waitPeerEvent(t, ch, pv.PeerIdentified, h.ID())
+	assertError(t, len(e.Protocols) > 0, "the identified event must have the protocols")
+	waitPeerEvent(t, dch, pv.PeerConnected, b.AddrInfo().ID)
+	assertError(t, len(b.ConnectedPeers()) == 1, "the peer must be connected")
+	assertError(t, len(d.ConnectedPeers()) == 1, "the bootstrap must be connected")
+
+	d.Close()
+	h.Close()
+	waitPeerEvent(t, ch, pv.PeerDisconnected, h.ID())
+	//the closing host may still have another connection for a moment
+	for i := 0; i < 50 && len(b.ConnectedPeers()) > 0; i++ {
+		time.Sleep(time.Millisecond * 100)
+	}
+	assertError(t, len(b.ConnectedPeers()) == 0, "the peer must be disconnected")
+	//the channel is closed with the DHT
+	for range dch {
+	}
+}
+
+func waitReconnectEvent(t *testing.T, ch <-chan pv.ReconnectEvent, connected bool) pv.ReconnectEvent {
+	timeout := time.After(time.Second * 15)
+	for {
+		select {
+		case ev, ok := <-ch:
+			assertError(t, ok, "the event channel is closed")
+			if ev.Connected == connected {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for a reconnect event:", connected)
+		}
+	}
+}
+func testReconnect(t *testing.T) {
+	defer os.RemoveAll("rc")
+	hGen := pv.NewHostGenerator(&pv.HostOpts{ListenAddrs: []string{"/ip4/127.0.0.1/tcp/0"}})
+	b, err := pv.NewPersistentBootstrap(hGen, "rc/key", "rc/data")
+	checkError(t, err)
+	bAddr := b.AddrInfo()
+	b.Close()
+
+	//the bootstrap is down, but Bootstrap does not fail
+	h, err := pv.SampleHost()
+	checkError(t, err)
+	defer h.Close()
+	d, err := pv.NewDHT(h)
+	checkError(t, err)
+	defer d.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	evCh := d.Reconnector().Subscribe(ctx)
+	checkError(t, d.Bootstrap("reconnect", []peer.AddrInfo{bAddr}))
+	ev := waitReconnectEvent(t, evCh, false)
+	assertError(t, ev.Err != nil && ev.Backoff > 0, "the failed attempt must have the error and the backoff")
+
+	//a bootstrap also starts while the other bootstrap is down
+	other, err := pv.NewBootstrap(pv.SampleHost, bAddr)
+	checkError(t, err)
+	defer other.Close()
+	otherCh := other.Reconnector().Subscribe(ctx)
+
+	//the restarted bootstrap is reconnected
+	addrs := make([]string, len(bAddr.Addrs))
+	for idx, addr := range bAddr.Addrs {
+		addrs[idx] = addr.String()
+	}
+	hGen = pv.NewHostGenerator(&pv.HostOpts{ListenAddrs: addrs})
+	b, err = pv.NewPersistentBootstrap(hGen, "rc/key", "rc/data")
+	checkError(t, err)
+	defer b.Close()
+	ev = waitReconnectEvent(t, evCh, true)
+	assertError(t, ev.Peer == bAddr.ID, "the bootstrap must be reconnected")
+	assertError(t, h.Network().Connectedness(bAddr.ID) == network.Connected, "the bootstrap must be connected")
+	ev = waitReconnectEvent(t, otherCh, true)
+	assertError(t, ev.Peer == bAddr.ID, "the bootstrap must be reconnected by the other bootstrap")
+}
+
+func testLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := pv.NewLogger(buf, pv.LevelInfo).With(pv.F("store", "name"))
+	logger.Debug("debug message")
+	logger.Info("info message", pv.F("mode", "log"))
+	assertError(t, !strings.Contains(buf.String(), "debug message"), "the debug message must be filtered")
+	assertError(t, strings.Contains(buf.String(), "INFO info message store=name mode=log"), "invalid log:", buf.String())
+
+	//the injected Logger receives the bootstrap connection errors
+	b, err := pv.NewBootstrap(pv.SampleHost)
+	checkError(t, err)
+	bAddr := b.AddrInfo()
+	b.Close()
+	h, err := pv.SampleHost()
+	checkError(t, err)
+	defer h.Close()
+	d, err := pv.NewDHT(h)
+	checkError(t, err)
+	buf.Reset()
+	d.SetLogger(pv.NewLogger(buf, pv.LevelWarn))
+	checkError(t, d.Bootstrap("logger", []peer.AddrInfo{bAddr}))
+	d.Close()
+	assertError(t, strings.Contains(buf.String(), "WARN bootstrap connection failed bootstrap="+bAddr.ID.String()), "invalid log:", buf.String())
+
+	//the first connection of a bootstrap is not logged as a reconnection
+	b, err = pv.NewBootstrap(pv.SampleHost)
+	checkError(t, err)
+	defer b.Close()
+	h1, err := pv.SampleHost()
+	checkError(t, err)
+	defer h1.Close()
+	d1, err := pv.NewDHT(h1)
+	checkError(t, err)
+	buf.Reset()
+	d1.SetLogger(pv.NewLogger(buf, pv.LevelInfo))
+	checkError(t, d1.Bootstrap("logger", []peer.AddrInfo{b.AddrInfo()}))
+	time.Sleep(time.Second)
+	d1.Close()
+	assertError(t, !strings.Contains(buf.String(), "bootstrap reconnected"), "invalid log:", buf.String())
+}
+
+func testMetrics(t *testing.T) {
+	m := pv.NewMetrics()
+	m.Describe("test_gauge", pv.GaugeMetric, "A test gauge.")
+	m.Inc("p2pverse_store_puts_total", "store", "a", "mode", "log")
+	m.Add("p2pverse_store_puts_total", 2, "store", "a", "mode", "log")
+	m.Observe("p2pverse_store_sync_seconds", 0.5, "store", "a")
+	m.Set("test_gauge", 3)
+	c := pv.CollectorFunc(func() []pv.Sample {
+		return []pv.Sample{{Name: "test_gauge", Labels: []string{"src", "collector"}, Value: 4}}
+	})
+	unregister := m.Register(c)
+	assertError(t, m.Value("p2pverse_store_puts_total", "store", "a") == 3, "invalid counter")
+	assertError(t, m.Value("test_gauge") == 7, "invalid gauge")
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	text := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE p2pverse_store_puts_total counter",
+		`p2pverse_store_puts_total{store="a",mode="log"} 3`,
+		"# TYPE p2pverse_store_sync_seconds summary",
+		`p2pverse_store_sync_seconds_count{store="a"} 1`,
+		`p2pverse_store_sync_seconds_sum{store="a"} 0.5`,
+		"# HELP test_gauge A test gauge.",
+		"test_gauge 3",
+		`test_gauge{src="collector"} 4`,
+	} {
+		assertError(t, strings.Contains(text, line+"\n"), "invalid metrics:", line, "\n", text)
+	}
+	assertError(t, strings.Count(text, "# TYPE p2pverse_store_sync_seconds ") == 1, "a family must be written once:", text)
+	unregister()
+	m.Delete("test_gauge")
+	assertError(t, m.Value("test_gauge") == 0, "the gauge must be deleted")
+
+	//ipfs blocks and crdt puts are recorded in DefaultMetrics
+	dm := pv.DefaultMetrics()
+	b, err := pv.NewBootstrap(pv.SampleHost)
+	checkError(t, err)
+	defer b.Close()
+	is, err := ipfs.NewIpfsStore(pv.SampleHost, "metrics_ipfs", false, b.AddrInfo())
+	checkError(t, err)
+	defer is.Close()
+	added, fetched := dm.Value("p2pverse_ipfs_bytes_added_total"), dm.Value("p2pverse_ipfs_bytes_fetched_total")
+	data := []byte("metrics test data")
+	cidStr, err := is.Add(data)
+	checkError(t, err)
+	_, err = is.Get(cidStr)
+	checkError(t, err)
+	assertError(t, dm.Value("p2pverse_ipfs_bytes_added_total")-added == float64(len(data)), "invalid bytes added")
+	assertError(t, dm.Value("p2pverse_ipfs_bytes_fetched_total")-fetched == float64(len(data)), "invalid bytes fetched")
+
+	defer os.RemoveAll("metrics_crdt")
+	cv := crdt.NewVerse(pv.SampleHost, "metrics_crdt", false, b.AddrInfo())
+	stName := "metrics test store"
+	st, err := cv.NewStore(stName, "log")
+	checkError(t, err)
+	defer st.Close()
+	checkError(t, st.Put("key", []byte("val")))
+	checkError(t, st.Sync())
+	assertError(t, dm.Value("p2pverse_store_puts_total", "store", stName, "mode", "log") == 2, "the initial put and the put must be counted")
+	assertError(t, dm.Value("p2pverse_store_sync_seconds_count", "store", stName) > 0, "the sync must be recorded")
+	assertError(t, dm.Value("p2pverse_store_dag_heads", "store", stName) > 0, "the DAG heads must be collected")
+}
+
+func testAddrInfo(t *testing.T) {
+	h1, err := pv.SampleHost()
+	checkError(t, err)
+	defer h1.Close()
+	h2, err := pv.SampleHost()
+	checkError(t, err)
+	defer h2.Close()
+	ai1, ai2 := pv.HostToAddrInfo(h1), pv.HostToAddrInfo(h2)
+
+	s := pv.FormatAddrInfos(ai1, ai2)
+	ais, err := pv.ParseAddrInfos(s)
+	checkError(t, err)
+	assertError(t, len(ais) == 2 && ais[0].ID == ai1.ID && ais[1].ID == ai2.ID, "invalid AddrInfos")
+	_, err = pv.ParseAddrInfo(s)
+	assertError(t, err != nil, "two peers must be rejected by ParseAddrInfo")
+	ai, err := pv.ParseAddrInfo(pv.FormatAddrInfos(ai1))
+	checkError(t, err)
+	assertError(t, ai.ID == ai1.ID && len(ai.Addrs) == len(ai1.Addrs), "invalid AddrInfo")
+
+	//a mistyped string is detected by the checksum
+	m, _ := base64.URLEncoding.DecodeString(s)
+	m[len(m)/2] ^= 0x01
+	_, err = pv.ParseAddrInfos(base64.URLEncoding.EncodeToString(m))
+	assertError(t, err != nil && strings.Contains(err.Error(), "checksum"), "a mistyped string must be rejected:", err)
+	_, err = pv.ParseAddrInfos(s[:len(s)-8])
+	assertError(t, err != nil, "a truncated string must be rejected")
+	_, err = pv.ParseAddrInfos("")
+	assertError(t, err == pv.ErrEmptyAddrInfo, "an empty string must be rejected")
+
+	//plain /p2p/ multiaddrs
+	p2pAddrs, err := peer.AddrInfoToP2pAddrs(&ai1)
+	checkError(t, err)
+	p2pAddr2, err := peer.AddrInfoToP2pAddrs(&ai2)
+	checkError(t, err)
+	ais, err = pv.ParseAddrInfos(p2pAddrs[0].String() + ", " + p2pAddr2[0].String())
+	checkError(t, err)
+	assertError(t, len(ais) == 2 && ais[0].ID == ai1.ID && ais[1].ID == ai2.ID, "invalid multiaddr AddrInfos")
+	_, err = pv.ParseAddrInfos(ai1.Addrs[0].String())
+	assertError(t, err != nil, "a multiaddr without /p2p/ must be rejected")
+
+	//the encoding before the version byte
+	mai := &pb.AddrInfo{ID: ai1.ID.String(), Addrs: [][]byte{ai1.Addrs[0].Bytes()}}
+	m, err = proto.Marshal(mai)
+	checkError(t, err)
+	ai, err = pv.ParseAddrInfo(base64.URLEncoding.EncodeToString(m))
+	checkError(t, err)
+	assertError(t, ai.ID == ai1.ID, "the legacy AddrInfo must be accepted")
+	m, err = proto.Marshal(&pb.AddrInfos{AddrInfos: []*pb.AddrInfo{mai}})
+	checkError(t, err)
+	ais, err = pv.ParseAddrInfos(base64.URLEncoding.EncodeToString(m))
+	checkError(t, err)
+	assertError(t, len(ais) == 1 && ais[0].ID == ai1.ID, "the legacy AddrInfos must be accepted")
+}
+
 func TestP2pVerse(t *testing.T) {
 
+	t.Log("===== addr info =====")
+	testAddrInfo(t)
+	t.Log("===== logger =====")
+	testLogger(t)
+	t.Log("===== metrics =====")
+	testMetrics(t)
+	t.Log("===== host generator =====")
+	testHostGenerator(t)
+	t.Log("===== private network =====")
+	testPrivateNetwork(t)
+	t.Log("===== gater =====")
+	testGater(t)
+	t.Log("===== peer events =====")
+	testPeerEvents(t)
+	t.Log("===== reconnect =====")
+	testReconnect(t)
+	t.Log("===== persistent bootstrap =====")
+	testPersistentBootstrap(t)
 	t.Log("===== bootstrap =====")
 	testBootstrap(t)
+	t.Log("===== discovery =====")
+	testDiscovery(t)
+	t.Log("===== concurrent discovery =====")
+	testConcurrentDiscovery(t)
+	t.Log("===== static discovery =====")
+	testStaticDiscovery(t)
 	t.Log("===== pubsub =====")
 	pubsub.BaseTestPubSub(t, pv.SampleHost)
 	t.Log("===== ipfs =====")
@@ -91,5 +679,7 @@ func TestP2pVerse(t *testing.T) {
 	crdt.BaseTestAccessController(t, pv.SampleHost)
 	t.Log("===== time =====")
 	crdt.BaseTestTimeLimit(t, pv.SampleHost)
+	t.Log("===== node =====")
+	crdt.BaseTestNode(t, pv.SampleHost)
 
 }
@@ -10,7 +10,6 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 
 	pb "github.com/pilinsin/p2p-verse/pb"
-	proto "google.golang.org/protobuf/proto"
 )
 
 func RandBytes(bSize int) []byte {
@@ -81,59 +80,26 @@ func pbToPeer(mai *pb.AddrInfo) (peer.AddrInfo, error) {
 	}, nil
 }
 
+//AddrInfoToString is FormatAddrInfos(ai).
 func AddrInfoToString(ai peer.AddrInfo) string {
-	mai := peerToPb(ai)
-	m, err := proto.Marshal(mai)
-	if err != nil {
-		return ""
-	}
-	return base64.URLEncoding.EncodeToString(m)
+	return FormatAddrInfos(ai)
 }
-func AddrInfoFromString(aiStr string) peer.AddrInfo {
-	m, err := base64.URLEncoding.DecodeString(aiStr)
-	if err != nil {
-		return peer.AddrInfo{}
-	}
 
-	mai := &pb.AddrInfo{}
-	if err := proto.Unmarshal(m, mai); err != nil {
-		return peer.AddrInfo{}
-	}
-
-	ai, _ := pbToPeer(mai)
+//AddrInfoFromString returns an empty AddrInfo on any failure.
+//Deprecated: use ParseAddrInfo, which returns the reason of the failure.
+func AddrInfoFromString(aiStr string) peer.AddrInfo {
+	ai, _ := ParseAddrInfo(aiStr)
 	return ai
 }
 
+//AddrInfosToString is FormatAddrInfos(ais...).
 func AddrInfosToString(ais ...peer.AddrInfo) string {
-	mais := make([]*pb.AddrInfo, len(ais))
-	for idx, ai := range ais {
-		mais[idx] = peerToPb(ai)
-	}
-	mais2 := &pb.AddrInfos{AddrInfos: mais}
-	m, err := proto.Marshal(mais2)
-	if err != nil {
-		return ""
-	}
-	return base64.URLEncoding.EncodeToString(m)
+	return FormatAddrInfos(ais...)
 }
-func AddrInfosFromString(sais string) []peer.AddrInfo {
-	m, err := base64.URLEncoding.DecodeString(sais)
-	if err != nil {
-		return nil
-	}
-
-	mais := &pb.AddrInfos{}
-	if err := proto.Unmarshal(m, mais); err != nil {
-		return nil
-	}
 
-	ais := make([]peer.AddrInfo, 0)
-	for _, mai := range mais.AddrInfos {
-		ai, err := pbToPeer(mai)
-		if err != nil {
-			continue
-		}
-		ais = append(ais, ai)
-	}
+//AddrInfosFromString returns nil on any failure.
+//Deprecated: use ParseAddrInfos, which returns the reason of the failure.
+func AddrInfosFromString(sais string) []peer.AddrInfo {
+	ais, _ := ParseAddrInfos(sais)
 	return ais
 }